@@ -0,0 +1,193 @@
+package xmux
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+const (
+	// maxConstraintLen is the maximum length of a regular expression
+	// constraint.
+	maxConstraintLen = 256
+	// maxConstraintInsts is the maximum number of instructions of the program
+	// compiled from a regular expression constraint.
+	maxConstraintInsts = 1000
+)
+
+// constraint restricts the values a named parameter can match.
+type constraint struct {
+	// name is the name of the parameter, without the constraint
+	name  string
+	match func(value string) bool
+}
+
+// constraintTypes holds the constraints usable with the :name<type> syntax.
+var constraintTypes = map[string]func(string) bool{
+	"int": func(s string) bool {
+		if len(s) > 1 && (s[0] == '-' || s[0] == '+') {
+			s = s[1:]
+		}
+		return isDigits(s)
+	},
+	"uint": isDigits,
+	"alpha": func(s string) bool {
+		return matchBytes(s, func(c byte) bool {
+			return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		})
+	},
+	"alnum": func(s string) bool {
+		return matchBytes(s, func(c byte) bool {
+			return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		})
+	},
+	"hex": func(s string) bool {
+		return matchBytes(s, func(c byte) bool {
+			return (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') || (c >= '0' && c <= '9')
+		})
+	},
+	"uuid": isUUID,
+}
+
+func isDigits(s string) bool {
+	return matchBytes(s, func(c byte) bool { return c >= '0' && c <= '9' })
+}
+
+// matchBytes tells if s is not empty and all its bytes satisfy f.
+func matchBytes(s string, f func(byte) bool) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !f(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isUUID tells if s is an UUID in its canonical 8-4-4-4-12 hex form.
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !((c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') || (c >= '0' && c <= '9')) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// wildcardEnd returns the end of the name and the end of the wildcard starting
+// at path[i]. A catch-all ends at the next '/' or the path end. The name of a
+// named parameter is made of letters, digits and '_', it may be followed by a
+// constraint enclosed in {}, <> or (), which may contain any char. The
+// returned end is -1 if the constraint is not terminated.
+func wildcardEnd(path string, i int) (nameEnd, end int) {
+	end = i + 1
+	if path[i] == '*' {
+		for end < len(path) && path[end] != '/' {
+			end++
+		}
+		return end, end
+	}
+	for end < len(path) && isNameChar(path[end]) {
+		end++
+	}
+	if end < len(path) {
+		switch path[end] {
+		case '{', '<', '(':
+			return end, constraintEnd(path, end)
+		}
+	}
+	return end, end
+}
+
+func isNameChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_'
+}
+
+// constraintEnd returns the index following the closing delimiter of the
+// constraint starting at path[i], or -1 if it is not terminated. Nested {} and
+// () pairs as well as escaped chars are skipped.
+func constraintEnd(path string, i int) int {
+	open, close := path[i], byte('>')
+	switch open {
+	case '{':
+		close = '}'
+	case '(':
+		close = ')'
+	}
+	depth := 0
+	for j := i; j < len(path); j++ {
+		switch c := path[j]; {
+		case c == '\\' && open != '<':
+			j++
+		case c == open:
+			depth++
+		case c == close:
+			if depth--; depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return -1
+}
+
+// newConstraint compiles the constraint c of the named parameter name. It
+// panics if the constraint is invalid.
+func newConstraint(name, c, fullPath string) *constraint {
+	body := c[1 : len(c)-1]
+	switch c[0] {
+	case '<':
+		match := constraintTypes[body]
+		if match == nil {
+			panic("unknown parameter type '" + body + "' in path '" + fullPath + "'")
+		}
+		return &constraint{name: name, match: match}
+
+	case '(':
+		values := strings.Split(body, "|")
+		for _, v := range values {
+			if v == "" {
+				panic("empty value in parameter enum '" + c + "' in path '" + fullPath + "'")
+			}
+		}
+		return &constraint{name: name, match: func(s string) bool {
+			for _, v := range values {
+				if s == v {
+					return true
+				}
+			}
+			return false
+		}}
+
+	default:
+		if len(body) > maxConstraintLen {
+			panic("parameter regular expression too long in path '" + fullPath + "'")
+		}
+		// Go regular expressions guarantee a matching time linear in the size
+		// of the input, the size of the program is limited too so a single
+		// constraint can't make the matching expensive.
+		re, err := syntax.Parse(body, syntax.Perl)
+		if err != nil {
+			panic("invalid parameter regular expression '" + body + "' in path '" +
+				fullPath + "': " + err.Error())
+		}
+		prog, err := syntax.Compile(re.Simplify())
+		if err != nil || len(prog.Inst) > maxConstraintInsts {
+			panic("parameter regular expression too complex '" + body + "' in path '" + fullPath + "'")
+		}
+		rx := regexp.MustCompile("^(?:" + body + ")$")
+		return &constraint{name: name, match: rx.MatchString}
+	}
+}
@@ -0,0 +1,70 @@
+package xmux
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/rs/xhandler"
+)
+
+// fallback serves the requests under a path prefix no route matches.
+type fallback struct {
+	prefix  string
+	handler xhandler.HandlerC
+}
+
+// SPAFallback registers handler to serve the GET and HEAD requests accepting
+// HTML whose path starts with prefix and no route matches, typically with the
+// index.html of a single-page app which routes them on the client side:
+//  mux.ServeFS("/app/assets/*filepath", assets)
+//  mux.SPAFallback("/app/", xhandler.HandlerFuncC(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+//      http.ServeFileFS(w, r, assets, "index.html")
+//  }))
+//
+// The fallback never shadows a registered route: it only applies once the
+// route lookup, the redirections and the MethodNotAllowed handling failed,
+// instead of the NotFound handler. Requests not explicitly accepting
+// text/html, like API calls, still get the NotFound handler. The longest
+// prefix wins if several fallbacks match.
+func (mux *Mux) SPAFallback(prefix string, handler xhandler.HandlerC) {
+	if prefix == "" || prefix[0] != '/' {
+		panic("path must begin with '/' in path '" + prefix + "'")
+	}
+	if prefix[len(prefix)-1] != '/' {
+		prefix += "/"
+	}
+	mux.update(func(t *table) {
+		for _, f := range t.fallbacks {
+			if f.prefix == prefix {
+				panic("a fallback is already registered for prefix '" + prefix + "'")
+			}
+		}
+		fallbacks := append(t.writeFallbacks(), &fallback{prefix: prefix, handler: handler})
+		sort.SliceStable(fallbacks, func(i, j int) bool {
+			return len(fallbacks[i].prefix) > len(fallbacks[j].prefix)
+		})
+		t.fallbacks = fallbacks
+	})
+}
+
+// SPAFallback registers the fallback handler of the requests under the prefix
+// of the group joined with prefix, see Mux.SPAFallback.
+func (g *Group) SPAFallback(prefix string, handler xhandler.HandlerC) {
+	g.m.SPAFallback(g.subPath(prefix), wrap(g.mws, handler))
+}
+
+// fallback returns the fallback handler for the request, if any.
+func (t *table) fallback(r *http.Request) xhandler.HandlerC {
+	if len(t.fallbacks) == 0 || (r.Method != "GET" && r.Method != "HEAD") ||
+		!accepts(r.Header.Get("Accept"), "text/html") {
+		return nil
+	}
+	path := r.URL.Path
+	for _, f := range t.fallbacks {
+		if strings.HasPrefix(path, f.prefix) || path == f.prefix[:len(f.prefix)-1] {
+			return f.handler
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package xmux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"context"
+
+	"github.com/rs/xhandler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMuxSPAFallback(t *testing.T) {
+	var outcome Outcome
+	text := func(s string) xhandler.HandlerC {
+		return xhandler.HandlerFuncC(func(_ context.Context, w http.ResponseWriter, _ *http.Request) {
+			w.Write([]byte(s))
+		})
+	}
+	mux := New()
+	mux.Use(func(next xhandler.HandlerC) xhandler.HandlerC {
+		return xhandler.HandlerFuncC(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			outcome = RouteOutcome(ctx)
+			next.ServeHTTPC(ctx, w, r)
+		})
+	})
+	mux.NotFound = xhandler.HandlerFuncC(func(_ context.Context, w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"not found"}`))
+	})
+	mux.ServeFS("/app/assets/*filepath", fstest.MapFS{
+		"main.js": &fstest.MapFile{Data: []byte("main()")},
+	})
+	mux.GET("/app/login", text("login"))
+	mux.POST("/app/form", text("form"))
+	mux.GET("/api/items", text("items"))
+	mux.SPAFallback("/app", text("app index"))
+	mux.NewGroup("/app/admin").SPAFallback("/", text("admin index"))
+
+	assert.Panics(t, func() { mux.SPAFallback("app/", text("")) })
+	assert.Panics(t, func() { mux.SPAFallback("/app/", text("")) })
+
+	const html = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+	tests := []struct {
+		method, path, accept string
+		code                 int
+		body                 string
+	}{
+		{"GET", "/app/", html, 200, "app index"},
+		{"GET", "/app", html, 200, "app index"},
+		{"GET", "/app/users/42", html, 200, "app index"},
+		{"HEAD", "/app/users/42", html, 200, "app index"},
+		{"GET", "/app/admin/users", html, 200, "admin index"},
+		{"GET", "/app/admin", html, 200, "admin index"},
+		{"GET", "/app/login", html, 200, "login"},
+		{"GET", "/app/assets/main.js", "*/*", 200, "main()"},
+		{"GET", "/app/assets/missing.js", "*/*", 404, "404 page not found\n"},
+		{"GET", "/app/login/", html, 301, ""},
+		{"GET", "/app/form", html, 405, "Method Not Allowed\n"},
+		{"POST", "/app/users", html, 404, `{"error":"not found"}`},
+		{"GET", "/app/users/42", "application/json", 404, `{"error":"not found"}`},
+		{"GET", "/app/users/42", "text/html;q=0", 404, `{"error":"not found"}`},
+		{"GET", "/application", html, 404, `{"error":"not found"}`},
+		{"GET", "/api/nope", html, 404, `{"error":"not found"}`},
+	}
+	for _, tt := range tests {
+		outcome = OutcomeUnknown
+		r, _ := http.NewRequest(tt.method, tt.path, nil)
+		r.Header.Set("Accept", tt.accept)
+		w := httptest.NewRecorder()
+		mux.ServeHTTPC(context.Background(), w, r)
+		assert.Equal(t, tt.code, w.Code, tt.path)
+		if tt.body != "" {
+			assert.Equal(t, tt.body, w.Body.String(), tt.path)
+		}
+		if tt.body == "app index" || tt.body == "admin index" {
+			assert.Equal(t, OutcomeFallback, outcome, tt.path)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package xmux
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"context"
+)
+
+// FSOption configures the file server registered with ServeFS.
+type FSOption func(*fileServer)
+
+// NoDirectoryListing makes the file server answer 404 (Not Found) to the
+// requests for a directory without an index.html file instead of listing its
+// content.
+func NoDirectoryListing() FSOption {
+	return func(fsrv *fileServer) {
+		fsrv.listing = false
+	}
+}
+
+// ServeFS serves files from the fsys file system, an embed.FS, os.DirFS or
+// any other fs.FS, for GET and HEAD requests. The path must end with
+// "/*filepath", files are then served from the value of the filepath
+// parameter:
+//  mux.ServeFS("/static/*filepath", staticFS)
+// For example if fsys holds css/main.css, it is served at
+// /static/css/main.css.
+//
+// Paths with ".." elements can't escape fsys. A directory is served by its
+// index.html file, if any, or else by a listing of its content unless
+// NoDirectoryListing is given. Files with a precompressed .br or .gz variant
+// are served compressed to the clients accepting it. Responses have an ETag
+// computed from the content of the file, conditional and range requests are
+// supported.
+func (mux *Mux) ServeFS(path string, fsys fs.FS, opts ...FSOption) {
+	h := newFileServer(path, fsys, opts)
+	mux.GET(path, h)
+	mux.HEAD(path, h)
+}
+
+// ServeFS serves files from the fsys file system, see Mux.ServeFS.
+func (g *Group) ServeFS(path string, fsys fs.FS, opts ...FSOption) {
+	h := newFileServer(path, fsys, opts)
+	g.GET(path, h)
+	g.HEAD(path, h)
+}
+
+// fileServer serves the files of an fs.FS.
+type fileServer struct {
+	fsys    fs.FS
+	listing bool
+
+	// ETags of the files, by name
+	mu    sync.Mutex
+	etags map[string]etagEntry
+}
+
+// etagEntry is the ETag of a file with the size and modification time it was
+// computed for.
+type etagEntry struct {
+	size    int64
+	modTime time.Time
+	etag    string
+}
+
+// precompressed are the precompressed variants of the files, by order of
+// preference.
+var precompressed = []struct {
+	name, ext string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+func newFileServer(path string, fsys fs.FS, opts []FSOption) *fileServer {
+	if len(path) < 10 || path[len(path)-10:] != "/*filepath" {
+		panic("path must end with /*filepath in path '" + path + "'")
+	}
+	fsrv := &fileServer{fsys: fsys, listing: true, etags: map[string]etagEntry{}}
+	for _, opt := range opts {
+		opt(fsrv)
+	}
+	return fsrv
+}
+
+func (fsrv *fileServer) ServeHTTPC(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	name := path.Clean(Param(ctx, "filepath"))
+	name = strings.TrimPrefix(name, "/")
+	if name == "" {
+		name = "."
+	}
+	if !fs.ValidPath(name) {
+		http.Error(w, "404 page not found", http.StatusNotFound)
+		return
+	}
+
+	fi, err := fs.Stat(fsrv.fsys, name)
+	if err != nil {
+		fsrv.error(w, err)
+		return
+	}
+	if fi.IsDir() {
+		// relative links of the listing or index need the trailing slash
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			raw := r.URL.RawPath
+			if raw != "" {
+				raw += "/"
+			}
+			u, ok := relativeURL(r.URL.Path+"/", raw, r.URL.RawQuery)
+			if !ok {
+				http.Error(w, "404 page not found", http.StatusNotFound)
+				return
+			}
+			http.Redirect(w, r, u, http.StatusMovedPermanently)
+			return
+		}
+		index := path.Join(name, "index.html")
+		if fi, err = fs.Stat(fsrv.fsys, index); err != nil || fi.IsDir() {
+			if !fsrv.listing {
+				http.Error(w, "404 page not found", http.StatusNotFound)
+				return
+			}
+			fsrv.list(w, r, name)
+			return
+		}
+		name = index
+	}
+
+	// Serve the precompressed variant of the file accepted by the client
+	w.Header().Add("Vary", "Accept-Encoding")
+	file, encoding := name, ""
+	accept := r.Header.Get("Accept-Encoding")
+	for _, enc := range precompressed {
+		if !accepts(accept, enc.name) {
+			continue
+		}
+		if efi, err := fs.Stat(fsrv.fsys, name+enc.ext); err == nil && !efi.IsDir() {
+			file, encoding, fi = name+enc.ext, enc.name, efi
+			break
+		}
+	}
+
+	f, err := fsrv.fsys.Open(file)
+	if err != nil {
+		fsrv.error(w, err)
+		return
+	}
+	defer f.Close()
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			fsrv.error(w, err)
+			return
+		}
+		content = bytes.NewReader(b)
+	}
+	etag, err := fsrv.etag(file, fi, content)
+	if err != nil {
+		fsrv.error(w, err)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
+	}
+	// the content type is guessed from the name of the uncompressed file
+	http.ServeContent(w, r, name, fi.ModTime(), content)
+}
+
+// etag returns the ETag of the file, computed from its content the first
+// time.
+func (fsrv *fileServer) etag(name string, fi fs.FileInfo, content io.ReadSeeker) (string, error) {
+	fsrv.mu.Lock()
+	e, found := fsrv.etags[name]
+	fsrv.mu.Unlock()
+	if found && e.size == fi.Size() && e.modTime.Equal(fi.ModTime()) {
+		return e.etag, nil
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	e = etagEntry{size: fi.Size(), modTime: fi.ModTime(), etag: `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`}
+	fsrv.mu.Lock()
+	fsrv.etags[name] = e
+	fsrv.mu.Unlock()
+	return e.etag, nil
+}
+
+// list writes the listing of the dir directory.
+func (fsrv *fileServer) list(w http.ResponseWriter, r *http.Request, dir string) {
+	entries, err := fs.ReadDir(fsrv.fsys, dir)
+	if err != nil {
+		fsrv.error(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == "HEAD" {
+		return
+	}
+	fmt.Fprintf(w, "<pre>\n")
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() {
+			name += "/"
+		}
+		u := url.URL{Path: name}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", u.String(), html.EscapeString(name))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+}
+
+func (fsrv *fileServer) error(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.Error(w, "404 page not found", http.StatusNotFound)
+	case errors.Is(err, fs.ErrPermission):
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+	default:
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// accepts tells if the accept header, like Accept or Accept-Encoding, lists
+// value explicitly and with a non-zero quality.
+func accepts(accept, value string) bool {
+	for _, v := range strings.Split(accept, ",") {
+		v = strings.TrimSpace(v)
+		params := ""
+		if i := strings.IndexByte(v, ';'); i >= 0 {
+			v, params = strings.TrimSpace(v[:i]), v[i+1:]
+		}
+		if !strings.EqualFold(v, value) {
+			continue
+		}
+		if q, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			v, err := strconv.ParseFloat(q, 64)
+			return err == nil && v > 0
+		}
+		return true
+	}
+	return false
+}
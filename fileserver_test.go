@@ -0,0 +1,101 @@
+package xmux
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//go:embed testdata/static
+var testStatic embed.FS
+
+func TestMuxServeFS(t *testing.T) {
+	static, err := fs.Sub(testStatic, "testdata/static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := New()
+	mux.ServeFS("/static/*filepath", static)
+	mux.NewGroup("/private").ServeFS("/*filepath", fstest.MapFS{
+		"secret/file.txt": &fstest.MapFile{Data: []byte("secret")},
+	}, NoDirectoryListing())
+
+	assert.Panics(t, func() { mux.ServeFS("/files/*path", static) })
+
+	serve := func(method, path string, header ...string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest(method, path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTPC(context.Background(), w, r)
+		return w
+	}
+
+	w := serve("GET", "/static/css/main.css")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "body{}\n", w.Body.String())
+	assert.Equal(t, "text/css; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	w = serve("GET", "/static/css/main.css", "If-None-Match", etag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	w = serve("HEAD", "/static/css/main.css")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "7", w.Header().Get("Content-Length"))
+	assert.Equal(t, "", w.Body.String())
+
+	// Precompressed variants
+	w = serve("GET", "/static/css/main.css", "Accept-Encoding", "gzip, br")
+	assert.Equal(t, "fake-br", w.Body.String())
+	assert.Equal(t, "br", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "text/css; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+	w = serve("GET", "/static/css/main.css", "Accept-Encoding", "gzip, br;q=0")
+	assert.Equal(t, "fake-gzip", w.Body.String())
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+
+	// Directories
+	w = serve("GET", "/static/")
+	assert.Equal(t, "<h1>Home</h1>\n", w.Body.String())
+	w = serve("GET", "/static/docs")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/static/docs/", w.Header().Get("Location"))
+	w = serve("GET", "/static/docs/")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<a href="README.txt">README.txt</a>`)
+	w = serve("GET", "/private/secret/")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = serve("GET", "/private/secret/file.txt")
+	assert.Equal(t, "secret", w.Body.String())
+
+	// Path traversal
+	for _, path := range []string{"/static/../fileserver.go", "/static/%2e%2e/fileserver.go", "/static/css/../../../mux.go"} {
+		w = serve("GET", path)
+		assert.NotEqual(t, http.StatusOK, w.Code, path)
+		assert.NotContains(t, w.Body.String(), "package xmux", path)
+	}
+	w = serve("GET", "/static/missing.css")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAccepts(t *testing.T) {
+	assert.True(t, accepts("gzip", "gzip"))
+	assert.True(t, accepts("br, GZIP;q=0.5", "gzip"))
+	assert.False(t, accepts("gzip;q=0", "gzip"))
+	assert.False(t, accepts("gzip;q=0.0", "gzip"))
+	assert.False(t, accepts("deflate", "gzip"))
+	assert.False(t, accepts("", "gzip"))
+	assert.True(t, accepts("text/html,application/xhtml+xml;q=0.9,*/*;q=0.8", "text/html"))
+	assert.False(t, accepts("*/*", "text/html"))
+}
@@ -2,6 +2,7 @@ package xmux
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/rs/xhandler"
 )
@@ -11,59 +12,89 @@ import (
 type Group struct {
 	m *Mux
 	p string
+	// prefix as given, for Request.Pattern
+	pattern string
+	mws     []func(next xhandler.HandlerC) xhandler.HandlerC
+	version string
 }
 
-func newRouteGroup(mux *Mux, path string) *Group {
-	if path[0] != '/' {
-		panic("path must begin with '/' in path '" + path + "'")
+func newRouteGroup(mux *Mux, pattern string) *Group {
+	if pattern[0] != '/' {
+		panic("path must begin with '/' in path '" + pattern + "'")
 	}
 
+	path := convertPattern(pattern)
+
 	//Strip traling / (if present) as all added sub paths must start with a /
 	if path[len(path)-1] == '/' {
 		path = path[:len(path)-1]
 	}
-	return &Group{m: mux, p: path}
+	return &Group{m: mux, p: path, pattern: strings.TrimSuffix(pattern, "/")}
 }
 
 // NewGroup creates a new sub routes group with the provided path prefix.
 // All routes added to the returned group will have the path prepended.
+// The sub group inherits the middleware registered on g at creation time.
 func (g *Group) NewGroup(path string) *Group {
-	return newRouteGroup(g.m, g.subPath(path))
+	sg := newRouteGroup(g.m, g.subPath(path))
+	sg.pattern = strings.TrimSuffix(g.pattern+path, "/")
+	sg.mws = append(sg.mws, g.mws...)
+	sg.version = g.version
+	return sg
+}
+
+// Version returns a copy of the group registering its routes for the given API
+// version, see Mux.Version.
+func (g *Group) Version(version string) *Group {
+	vg := *g
+	vg.mws = g.mws[:len(g.mws):len(g.mws)]
+	vg.version = checkVersion(version)
+	return &vg
+}
+
+// Use appends context-aware middleware to the group. The middleware is applied
+// to every route registered on the group (or on its sub groups) after the call,
+// in the order they were added, the first one being the outermost.
+//
+// Middleware is applied once at registration time so it adds no routing
+// overhead per request.
+func (g *Group) Use(mws ...func(next xhandler.HandlerC) xhandler.HandlerC) {
+	g.mws = append(g.mws, mws...)
 }
 
 // GET is a shortcut for g.Handle("GET", path, handler)
-func (g *Group) GET(path string, handler xhandler.HandlerC) {
-	g.HandleC("GET", path, handler)
+func (g *Group) GET(path string, handler xhandler.HandlerC) *Route {
+	return g.HandleC("GET", path, handler)
 }
 
 // HEAD is a shortcut for g.Handle("HEAD", path, handler)
-func (g *Group) HEAD(path string, handler xhandler.HandlerC) {
-	g.HandleC("HEAD", path, handler)
+func (g *Group) HEAD(path string, handler xhandler.HandlerC) *Route {
+	return g.HandleC("HEAD", path, handler)
 }
 
 // OPTIONS is a shortcut for g.Handle("OPTIONS", path, handler)
-func (g *Group) OPTIONS(path string, handler xhandler.HandlerC) {
-	g.HandleC("OPTIONS", path, handler)
+func (g *Group) OPTIONS(path string, handler xhandler.HandlerC) *Route {
+	return g.HandleC("OPTIONS", path, handler)
 }
 
 // POST is a shortcut for g.Handle("POST", path, handler)
-func (g *Group) POST(path string, handler xhandler.HandlerC) {
-	g.HandleC("POST", path, handler)
+func (g *Group) POST(path string, handler xhandler.HandlerC) *Route {
+	return g.HandleC("POST", path, handler)
 }
 
 // PUT is a shortcut for g.Handle("PUT", path, handler)
-func (g *Group) PUT(path string, handler xhandler.HandlerC) {
-	g.HandleC("PUT", path, handler)
+func (g *Group) PUT(path string, handler xhandler.HandlerC) *Route {
+	return g.HandleC("PUT", path, handler)
 }
 
 // PATCH is a shortcut for g.Handle("PATCH", path, handler)
-func (g *Group) PATCH(path string, handler xhandler.HandlerC) {
-	g.HandleC("PATCH", path, handler)
+func (g *Group) PATCH(path string, handler xhandler.HandlerC) *Route {
+	return g.HandleC("PATCH", path, handler)
 }
 
 // DELETE is a shortcut for g.Handle("DELETE", path, handler)
-func (g *Group) DELETE(path string, handler xhandler.HandlerC) {
-	g.HandleC("DELETE", path, handler)
+func (g *Group) DELETE(path string, handler xhandler.HandlerC) *Route {
+	return g.HandleC("DELETE", path, handler)
 }
 
 // HandleC registers a context aware request handler with the given
@@ -75,33 +106,33 @@ func (g *Group) DELETE(path string, handler xhandler.HandlerC) {
 // This function is intended for bulk loading and to allow the usage of less
 // frequently used, non-standardized or custom methods (e.g. for internal
 // communication with a proxy).
-func (g *Group) HandleC(method, path string, handler xhandler.HandlerC) {
-	g.m.HandleC(method, g.subPath(path), handler)
+func (g *Group) HandleC(method, path string, handler xhandler.HandlerC) *Route {
+	return g.m.handle(method, g.subPath(path), g.pattern+path, g.version, false, wrap(g.mws, handler))
 }
 
-// Handle regiester a standard http.Handler request handler with the given
-// path and method. With this adapter, your handler won't have access to the
-// context and thus won't work with URL parameters.
-func (g *Group) Handle(method, path string, handler http.Handler) {
-	g.m.Handle(method, g.subPath(path), handler)
+// Handle registers a standard http.Handler request handler with the given
+// path and method. The URL parameters are stored in the context of the request
+// passed to the handler, see ParamsFromRequest.
+func (g *Group) Handle(method, path string, handler http.Handler) *Route {
+	return g.HandleC(method, path, httpHandler(handler))
 }
 
 // HandleFunc registers a standard http.HandlerFunc request handler with the given
-// path and method. With this adapter, your handler won't have access to the
-// context and thus won't work with URL parameters.
-func (g *Group) HandleFunc(method, path string, handler http.HandlerFunc) {
-	g.m.HandleFunc(method, g.subPath(path), handler)
+// path and method. The URL parameters are stored in the context of the request
+// passed to the handler, see ParamsFromRequest.
+func (g *Group) HandleFunc(method, path string, handler http.HandlerFunc) *Route {
+	return g.HandleC(method, path, httpHandler(handler))
 }
 
 // HandleFuncC registers a standard xhandler.HandlerFuncC request handler with
 // the given path and method.
-func (g *Group) HandleFuncC(method, path string, handler xhandler.HandlerFuncC) {
-	g.m.HandleFuncC(method, g.subPath(path), handler)
+func (g *Group) HandleFuncC(method, path string, handler xhandler.HandlerFuncC) *Route {
+	return g.HandleC(method, path, handler)
 }
 
 func (g *Group) subPath(path string) string {
 	if path[0] != '/' {
 		panic("path must start with a '/'")
 	}
-	return g.p + path
+	return g.p + convertPattern(path)
 }
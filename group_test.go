@@ -139,3 +139,53 @@ func TestRouteGroupAPI(t *testing.T) {
 	mux.ServeHTTPC(context.Background(), w, r)
 	assert.True(t, ctx, "routing /foo/Context failed")
 }
+
+func TestRouteGroupUse(t *testing.T) {
+	var trace []string
+	mw := func(name string) func(next xhandler.HandlerC) xhandler.HandlerC {
+		return func(next xhandler.HandlerC) xhandler.HandlerC {
+			return xhandler.HandlerFuncC(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+				trace = append(trace, name)
+				next.ServeHTTPC(ctx, w, r)
+			})
+		}
+	}
+	h := func(name string) xhandler.HandlerC {
+		return xhandler.HandlerFuncC(func(_ context.Context, _ http.ResponseWriter, _ *http.Request) {
+			trace = append(trace, name)
+		})
+	}
+
+	mux := New()
+	mux.GET("/plain", h("plain"))
+	foo := mux.NewGroup("/foo")
+	foo.GET("/before", h("before"))
+	foo.Use(mw("a"), mw("b"))
+	foo.GET("/after", h("after"))
+	foo.HandleFunc("GET", "/func", func(_ http.ResponseWriter, _ *http.Request) {
+		trace = append(trace, "func")
+	})
+	bar := foo.NewGroup("/bar")
+	bar.Use(mw("c"))
+	bar.GET("/nested", h("nested"))
+	foo.Use(mw("late"))
+	foo.GET("/late", h("late-handler"))
+
+	tests := []struct {
+		path  string
+		trace []string
+	}{
+		{"/plain", []string{"plain"}},
+		{"/foo/before", []string{"before"}},
+		{"/foo/after", []string{"a", "b", "after"}},
+		{"/foo/func", []string{"a", "b", "func"}},
+		{"/foo/bar/nested", []string{"a", "b", "c", "nested"}},
+		{"/foo/late", []string{"a", "b", "late", "late-handler"}},
+	}
+	for _, tt := range tests {
+		trace = nil
+		r, _ := http.NewRequest("GET", tt.path, nil)
+		mux.ServeHTTPC(context.Background(), new(mockResponseWriter), r)
+		assert.Equal(t, tt.trace, trace, tt.path)
+	}
+}
@@ -0,0 +1,188 @@
+package xmux
+
+import (
+	"strings"
+
+	"github.com/rs/xhandler"
+)
+
+// hostRoute routes the requests for the hosts matching a pattern to the
+// muxer of these hosts.
+type hostRoute struct {
+	pattern string
+	// labels of the host name, '*' for a wildcard subdomain as the first
+	// label and {name} for parameters
+	labels []string
+	// port of the pattern, empty if any port matches
+	port string
+	// exact is true if the pattern has no parameter nor wildcard
+	exact bool
+	mux   *Mux
+}
+
+// Host returns the muxer of the requests whose Host header matches pattern.
+// The routes registered on the returned muxer only match these hosts, while
+// the routes of mux serve the requests for the other hosts. Calling Host again
+// with the same pattern returns the same muxer.
+//
+// The pattern is a host name, optionally followed by a port. A {name} label
+// matches any label and is saved as a parameter, available with Params(ctx)
+// before the parameters of the route. A '*' first label matches one or more
+// subdomain labels. The port, if any, must match the port of the request or
+// can be a {name} parameter too. Host names are compared case-insensitively:
+//  mux.Host("api.example.com")
+//  mux.Host("{tenant}.example.com")
+//  mux.Host("*.example.com:8080")
+//
+// Exact host names take priority over the other patterns, which are tried in
+// the order they were added. The host muxer uses the options, the
+// PanicHandler and the middleware of mux, read from mux when the requests are
+// served so options set after the call apply as well. It answers the requests
+// none of its routes match with its own NotFound and MethodNotAllowed
+// handlers if set, with the ones of mux otherwise.
+func (mux *Mux) Host(pattern string) *Mux {
+	for _, h := range mux.load().hosts {
+		if h.pattern == pattern {
+			return h.mux
+		}
+	}
+	var h *hostRoute
+	mux.update(func(t *table) {
+		for _, prev := range t.hosts {
+			if prev.pattern == pattern {
+				// added concurrently
+				h = prev
+				return
+			}
+		}
+		h = newHostRoute(pattern)
+		h.mux = &Mux{parent: mux.ref()}
+		// exact hosts first
+		hosts := t.writeHosts()
+		i := len(hosts)
+		if h.exact {
+			for i = 0; i < len(hosts) && hosts[i].exact; i++ {
+			}
+		}
+		hosts = append(hosts, nil)
+		copy(hosts[i+1:], hosts[i:])
+		hosts[i] = h
+		t.hosts = hosts
+	})
+	return h.mux
+}
+
+// opts returns the muxer whose options apply to mux: mux itself, or the
+// muxer a host muxer was created from.
+func (mux *Mux) opts() *Mux {
+	for mux.parent != nil {
+		mux = mux.parent.mux.Load()
+	}
+	return mux
+}
+
+// middleware returns the middleware wrapping the handlers of mux, starting
+// with the middleware inherited by a host muxer.
+func (mux *Mux) middleware() []func(next xhandler.HandlerC) xhandler.HandlerC {
+	if mux.parent == nil {
+		return mux.mws
+	}
+	mws := mux.parent.mux.Load().middleware()
+	return append(mws[:len(mws):len(mws)], mux.mws...)
+}
+
+func newHostRoute(pattern string) *hostRoute {
+	h := &hostRoute{pattern: pattern, exact: true}
+	host := pattern
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && i > strings.LastIndexByte(host, ']') {
+		host, h.port = host[:i], host[i+1:]
+		if h.port == "" {
+			panic("empty port in host '" + pattern + "'")
+		}
+		if isHostParam(h.port) {
+			h.exact = false
+		}
+	}
+	if host == "" {
+		panic("empty host name in host '" + pattern + "'")
+	}
+	h.labels = strings.Split(host, ".")
+	for i, l := range h.labels {
+		switch {
+		case l == "":
+			panic("empty label in host '" + pattern + "'")
+		case l == "*":
+			if i > 0 {
+				panic("wildcard must be the first label in host '" + pattern + "'")
+			}
+			h.exact = false
+		case isHostParam(l):
+			if len(l) == 2 {
+				panic("host parameters must be named with a non-empty name in host '" + pattern + "'")
+			}
+			h.exact = false
+		case strings.ContainsAny(l, "{}*"):
+			panic("host parameters must span a whole label in host '" + pattern + "'")
+		}
+	}
+	return h
+}
+
+func isHostParam(l string) bool {
+	return len(l) >= 2 && l[0] == '{' && l[len(l)-1] == '}'
+}
+
+// match tells if host matches the pattern and returns the parameters of the
+// pattern.
+func (h *hostRoute) match(host string) (ps ParamHolder, ok bool) {
+	port := ""
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && i > strings.LastIndexByte(host, ']') {
+		host, port = host[:i], host[i+1:]
+	}
+	if h.port != "" && (port == "" || (port != h.port && !isHostParam(h.port))) {
+		return nil, false
+	}
+	// a fully qualified host name may end with a dot
+	host = strings.TrimSuffix(host, ".")
+
+	// compare the labels from the right
+	for j := len(h.labels) - 1; j >= 0; j-- {
+		l := h.labels[j]
+		if l == "*" {
+			// one or more labels left
+			if host == "" {
+				return nil, false
+			}
+			host = ""
+			break
+		}
+		if host == "" {
+			return nil, false
+		}
+		label := host
+		if k := strings.LastIndexByte(host, '.'); k >= 0 {
+			label, host = host[k+1:], host[:k]
+		} else {
+			host = ""
+		}
+		if isHostParam(l) {
+			if label == "" {
+				return nil, false
+			}
+			ps = append(ps, Parameter{Name: l[1 : len(l)-1], Value: label})
+		} else if !strings.EqualFold(label, l) {
+			return nil, false
+		}
+	}
+	if host != "" {
+		return nil, false
+	}
+	// the labels were matched from the right
+	for i, j := 0, len(ps)-1; i < j; i, j = i+1, j-1 {
+		ps[i], ps[j] = ps[j], ps[i]
+	}
+	if isHostParam(h.port) {
+		ps = append(ps, Parameter{Name: h.port[1 : len(h.port)-1], Value: port})
+	}
+	return ps, true
+}
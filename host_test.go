@@ -0,0 +1,139 @@
+package xmux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"context"
+
+	"github.com/rs/xhandler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		host    string
+		ok      bool
+		ps      ParamHolder
+	}{
+		{"example.com", "example.com", true, nil},
+		{"example.com", "EXAMPLE.com:8080", true, nil},
+		{"example.com", "example.com.", true, nil},
+		{"example.com", "www.example.com", false, nil},
+		{"example.com", "example.org", false, nil},
+		{"{tenant}.example.com", "acme.example.com", true, newParams("tenant", "acme")},
+		{"{tenant}.example.com", "a.b.example.com", false, nil},
+		{"{tenant}.example.com", "example.com", false, nil},
+		{"{tenant}.{region}.example.com", "acme.eu.example.com", true, newParams("tenant", "acme", "region", "eu")},
+		{"*.example.com", "a.b.example.com", true, nil},
+		{"*.example.com", "example.com", false, nil},
+		{"*.{zone}.com", "www.example.com", true, newParams("zone", "example")},
+		{"example.com:8080", "example.com:8080", true, nil},
+		{"example.com:8080", "example.com:8081", false, nil},
+		{"example.com:8080", "example.com", false, nil},
+		{"example.com:{port}", "example.com:8080", true, newParams("port", "8080")},
+		{"{tenant}.example.com:{port}", "acme.example.com:80", true, newParams("tenant", "acme", "port", "80")},
+	}
+	for _, tt := range tests {
+		ps, ok := newHostRoute(tt.pattern).match(tt.host)
+		assert.Equal(t, tt.ok, ok, "%s %s", tt.pattern, tt.host)
+		if tt.ok {
+			assert.Equal(t, tt.ps, ps, "%s %s", tt.pattern, tt.host)
+		}
+	}
+
+	for _, pattern := range []string{"", ":80", "example.com:", "a..com", "www.*.com", "{}.example.com", "{a}b.example.com"} {
+		assert.Panics(t, func() { newHostRoute(pattern) }, pattern)
+	}
+}
+
+func TestMuxHost(t *testing.T) {
+	handler := func(name string) xhandler.HandlerFuncC {
+		return func(ctx context.Context, w http.ResponseWriter, _ *http.Request) {
+			w.Write([]byte(name))
+			for _, p := range Params(ctx) {
+				w.Write([]byte(" " + p.Name + "=" + p.Value))
+			}
+		}
+	}
+
+	mux := New()
+	mux.GET("/", handler("default"))
+	tenant := mux.Host("{tenant}.example.com")
+	tenant.GET("/users/:id", handler("tenant"))
+	tenant.NotFound = handler("tenant not found")
+	api := mux.Host("api.example.com")
+	api.GET("/", handler("api"))
+	api.NewGroup("/v1").POST("/items", handler("api items"))
+	assert.Equal(t, tenant, mux.Host("{tenant}.example.com"))
+
+	tests := []struct {
+		method, host, path string
+		code               int
+		body               string
+	}{
+		{"GET", "acme.example.com", "/users/42", 200, "tenant tenant=acme id=42"},
+		{"GET", "acme.example.com", "/", 200, "tenant not found tenant=acme"},
+		{"GET", "api.example.com", "/", 200, "api"},
+		{"POST", "api.example.com:443", "/v1/items", 200, "api items"},
+		{"GET", "api.example.com", "/v1/items", 405, "Method Not Allowed\n"},
+		{"GET", "example.com", "/", 200, "default"},
+		{"GET", "example.com", "/users/42", 404, "404 page not found\n"},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest(tt.method, "http://"+tt.host+tt.path, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTPC(context.Background(), w, r)
+		assert.Equal(t, tt.code, w.Code, "%s %s%s", tt.method, tt.host, tt.path)
+		assert.Equal(t, tt.body, w.Body.String(), "%s %s%s", tt.method, tt.host, tt.path)
+	}
+
+	assert.Panics(t, func() { mux.Use(func(next xhandler.HandlerC) xhandler.HandlerC { return next }) })
+}
+
+func TestMuxHostOptions(t *testing.T) {
+	mux := New()
+	api := mux.Host("api.example.com")
+	var served []string
+	mux.Use(func(next xhandler.HandlerC) xhandler.HandlerC {
+		return xhandler.HandlerFuncC(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			served = append(served, r.URL.Path)
+			next.ServeHTTPC(ctx, w, r)
+		})
+	})
+	api.GET("/users/:id", xhandler.HandlerFuncC(func(_ context.Context, w http.ResponseWriter, _ *http.Request) {}))
+	// set after the host muxer was created
+	mux.RedirectTrailingSlash = false
+	mux.NotFound = xhandler.HandlerFuncC(func(_ context.Context, w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	r, _ := http.NewRequest("GET", "http://api.example.com/users/42/", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTPC(context.Background(), w, r)
+	assert.Equal(t, http.StatusTeapot, w.Code)
+
+	r, _ = http.NewRequest("GET", "http://api.example.com/users/42", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTPC(context.Background(), w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"/users/42/", "/users/42"}, served)
+
+	mux.GET("/", xhandler.HandlerFuncC(func(_ context.Context, w http.ResponseWriter, _ *http.Request) {}))
+	routes := mux.Routes()
+	if assert.Len(t, routes, 2) {
+		assert.Equal(t, "", routes[0].Host)
+		assert.Equal(t, "/", routes[0].Pattern)
+		assert.Equal(t, "api.example.com", routes[1].Host)
+		assert.Equal(t, "/users/:id", routes[1].Pattern)
+	}
+	patterns := []string{}
+	mux.Walk(func(method, pattern string, _ xhandler.HandlerC) error {
+		patterns = append(patterns, method+" "+pattern)
+		return nil
+	})
+	assert.Equal(t, []string{"GET /", "GET api.example.com/users/:id"}, patterns)
+	assert.Panics(t, func() { mux.Use(func(next xhandler.HandlerC) xhandler.HandlerC { return next }) })
+}
@@ -0,0 +1,188 @@
+package xmux
+
+import (
+	"bytes"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"context"
+
+	"github.com/rs/xhandler"
+)
+
+// mountParam is the name of the catch-all parameter of the mount routes.
+const mountParam = "mountpath"
+
+// Mount serves all the requests under prefix with handler, see MountC. The
+// parameters of the prefix are stored in the context of the request, see
+// ParamsFromRequest.
+func (mux *Mux) Mount(prefix string, handler http.Handler) {
+	mux.MountC(prefix, httpHandler(handler))
+}
+
+// MountC serves the requests for prefix and all the paths under it with
+// handler, for any method, like another Mux built independently:
+//  admin := xmux.New()
+//  admin.GET("/users", ListUsers)
+//  mux.MountC("/admin", admin)
+//
+// The prefix is stripped from the Path and RawPath of the request URL before
+// calling handler, so the request for /admin/users is served by the /users
+// route of admin, and the request for /admin by its / route. The prefix can
+// have parameters, like /orgs/:org, which handler gets with Params(ctx) before
+// its own, but no optional parameter. The mount is registered once for any
+// method, like the patterns without method of HandlePatternC: the routes
+// registered for the method of a request under prefix take precedence. The
+// redirections to an absolute path issued by handler, like the trailing slash
+// redirections of a Mux, are prefixed so they point to the external URL.
+func (mux *Mux) MountC(prefix string, handler xhandler.HandlerC) {
+	for _, route := range mountRoutes(prefix, handler) {
+		mux.handle("", route.path, route.path, "", false, route.handler)
+	}
+}
+
+// Mount serves all the requests under the prefix of the group joined with
+// prefix with handler, see Mux.MountC.
+func (g *Group) Mount(prefix string, handler http.Handler) {
+	g.MountC(prefix, httpHandler(handler))
+}
+
+// MountC serves all the requests under the prefix of the group joined with
+// prefix with handler, see Mux.MountC.
+func (g *Group) MountC(prefix string, handler xhandler.HandlerC) {
+	for _, route := range mountRoutes(g.subPath(prefix), handler) {
+		g.m.handle("", route.path, route.path, g.version, false, wrap(g.mws, route.handler))
+	}
+}
+
+// mountRoute is one of the routes serving the requests of a mount.
+type mountRoute struct {
+	path    string
+	handler xhandler.HandlerC
+}
+
+// mountRoutes returns the routes serving the requests for prefix and under it
+// with handler, the first one for prefix itself if not the root.
+func mountRoutes(prefix string, handler xhandler.HandlerC) []mountRoute {
+	if prefix == "" || prefix[0] != '/' {
+		panic("path must begin with '/' in path '" + prefix + "'")
+	}
+	prefix = strings.TrimRight(convertPattern(prefix), "/")
+	if strings.ContainsRune(prefix, '*') {
+		panic("catch-all routes can't be mounted in path '" + prefix + "'")
+	}
+	// the variant without an optional parameter would conflict with the
+	// catch-all of the one with it
+	if len(expandOptional(prefix)) > 1 {
+		panic("optional parameters can't be mounted in path '" + prefix + "'")
+	}
+	routes := []mountRoute{{path: prefix + "/*" + mountParam, handler: mountHandler{handler, false}}}
+	if prefix != "" {
+		routes = append([]mountRoute{{path: prefix, handler: mountHandler{handler, true}}}, routes...)
+	}
+	return routes
+}
+
+// mountHandler strips the mount prefix from the requests of a mounted handler.
+type mountHandler struct {
+	handler xhandler.HandlerC
+	// exact is true for the route of the prefix itself
+	exact bool
+}
+
+func (h mountHandler) ServeHTTPC(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	rest := "/"
+	if !h.exact {
+		ps := Params(ctx)
+		rest = ps[len(ps)-1].Value
+		ctx = newParamContext(ctx, ps[:len(ps)-1])
+	}
+	u := *r.URL
+	u.Path, u.RawPath = rest, ""
+	prefix := r.URL.Path
+	if !h.exact {
+		prefix = prefix[:len(prefix)-len(rest)]
+	}
+	rawPrefix := (&url.URL{Path: prefix}).EscapedPath()
+	if raw := r.URL.RawPath; raw != "" {
+		if i := rawSplit(raw, rest, h.exact); i >= 0 {
+			rawPrefix = raw[:i]
+			if !h.exact {
+				u.RawPath = raw[i:]
+			}
+		}
+	}
+
+	r2 := r.WithContext(r.Context())
+	r2.URL = &u
+	h.handler.ServeHTTPC(ctx, &mountResponseWriter{ResponseWriter: w, prefix: rawPrefix}, r2)
+}
+
+// rawSplit returns the index where raw, the escaped form of a path, is split
+// between the mount prefix and the escaped form of rest, or -1 if not found.
+func rawSplit(raw, rest string, exact bool) int {
+	if exact {
+		return len(raw)
+	}
+	for i := len(raw) - 1; i >= 0; i-- {
+		if raw[i] != '/' {
+			continue
+		}
+		if p, err := url.PathUnescape(raw[i:]); err == nil && p == rest {
+			return i
+		}
+	}
+	return -1
+}
+
+// mountResponseWriter prefixes the absolute path redirections of a mounted
+// handler with the mount prefix.
+//
+// The link to the location in the body of the redirection, as written by
+// http.Redirect and the redirections of a Mux, is prefixed as well. Other
+// bodies are written as is, a link split across several writes included.
+type mountResponseWriter struct {
+	http.ResponseWriter
+	prefix string
+	// href attribute of the unprefixed location and its replacement, set
+	// once the Location header is prefixed
+	href, prefixed []byte
+}
+
+func (w *mountResponseWriter) WriteHeader(code int) {
+	if code >= 300 && code < 400 {
+		h := w.Header()
+		if loc := h.Get("Location"); strings.HasPrefix(loc, "/") && !strings.HasPrefix(loc, "//") {
+			h.Set("Location", w.prefix+loc)
+			w.href = []byte(`href="` + html.EscapeString(loc) + `"`)
+			w.prefixed = []byte(`href="` + html.EscapeString(w.prefix+loc) + `"`)
+			// the body gets longer
+			h.Del("Content-Length")
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *mountResponseWriter) Write(b []byte) (int, error) {
+	if w.href == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	if _, err := w.ResponseWriter.Write(bytes.Replace(b, w.href, w.prefixed, -1)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Flush implements http.Flusher if the underlying writer does.
+func (w *mountResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (w *mountResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
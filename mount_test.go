@@ -0,0 +1,79 @@
+package xmux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"context"
+
+	"github.com/rs/xhandler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMuxMount(t *testing.T) {
+	admin := New()
+	admin.GET("/", xhandler.HandlerFuncC(func(_ context.Context, w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("home"))
+	}))
+	admin.GET("/users/:name", xhandler.HandlerFuncC(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(Params(ctx).Get("org") + " " + Param(ctx, "name") + " " + r.URL.EscapedPath()))
+	}))
+	admin.POST("/items/", xhandler.HandlerFuncC(func(_ context.Context, w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("created"))
+	}))
+	admin.HandleC("PROPFIND", "/files", xhandler.HandlerFuncC(func(_ context.Context, w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("props"))
+	}))
+
+	mux := New()
+	mux.MountC("/orgs/:org/admin", admin)
+	mux.Mount("/std/", http.StripPrefix("/files", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/target", http.StatusFound)
+			return
+		}
+		w.Write([]byte(r.URL.Path))
+	})))
+	mux.NewGroup("/v1").MountC("/", admin)
+
+	assert.Panics(t, func() { mux.MountC("admin", admin) })
+	assert.Panics(t, func() { mux.MountC("/std", admin) })
+	assert.PanicsWithValue(t, "optional parameters can't be mounted in path '/docs/:v?=1'", func() {
+		mux.MountC("/docs/:v?=1", admin)
+	})
+
+	tests := []struct {
+		method, path string
+		code         int
+		body         string
+		location     string
+	}{
+		{"GET", "/orgs/acme/admin", 200, "home", ""},
+		{"GET", "/orgs/acme/admin/", 200, "home", ""},
+		{"GET", "/orgs/acme/admin/users/gopher", 200, "acme gopher /users/gopher", ""},
+		{"GET", "/orgs/a%2Cb/admin/users/go%2Cpher", 200, "a,b go,pher /users/go%2Cpher", ""},
+		{"GET", "/orgs/acme/admin/users/gopher/", 301, "<a href=\"/orgs/acme/admin/users/gopher\">Moved Permanently</a>.\n\n", "/orgs/acme/admin/users/gopher"},
+		{"GET", "/orgs/a%2Cb/admin/Users/gopher", 301, "<a href=\"/orgs/a%2Cb/admin/users/gopher\">Moved Permanently</a>.\n\n", "/orgs/a%2Cb/admin/users/gopher"},
+		{"POST", "/orgs/acme/admin/items", 307, "", "/orgs/acme/admin/items/"},
+		{"DELETE", "/orgs/acme/admin/items/", 405, "Method Not Allowed\n", ""},
+		{"GET", "/orgs/acme/admin/nope", 404, "404 page not found\n", ""},
+		{"PROPFIND", "/orgs/acme/admin/files", 200, "props", ""},
+		{"PROPFIND", "/v1/files", 200, "props", ""},
+		{"GET", "/std/files/a.txt", 200, "/a.txt", ""},
+		{"PUT", "/std", 404, "404 page not found\n", ""},
+		{"GET", "/v1/users/gopher", 200, " gopher /users/gopher", ""},
+		{"GET", "/v1", 200, "home", ""},
+		{"GET", "/std/files/redirect", 302, "<a href=\"/std/target\">Found</a>.\n\n", "/std/target"},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest(tt.method, tt.path, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTPC(context.Background(), w, r)
+		assert.Equal(t, tt.code, w.Code, tt.path)
+		if tt.body != "" {
+			assert.Equal(t, tt.body, w.Body.String(), tt.path)
+		}
+		assert.Equal(t, tt.location, w.Header().Get("Location"), tt.path)
+	}
+}
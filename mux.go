@@ -53,6 +53,37 @@
 //   /blog/go/                           no match
 //   /blog/go/request-routers/comments   no match
 //
+// Static segments take priority over named parameters registered for the same
+// position: with /blog/:category/:post and /blog/go/latest registered,
+// /blog/go/latest matches the latter while /blog/go/other matches the former.
+//
+// Named parameters can be mixed with static text in a segment. Their name is
+// made of letters, digits and '_', and they stop matching at the first char
+// which can follow them in the segment:
+//  Path: /files/:name.:ext
+//
+//  Requests:
+//   /files/app.js                       match: name="app", ext="js"
+//   /files/app.tar.gz                   match: name="app", ext="tar.gz"
+//
+// Named parameters can be followed by a constraint on their value. A request
+// with a value not satisfying the constraint doesn't match the route:
+//  Syntax          Constraint
+//  :id{[0-9]+}     regular expression matching the whole value
+//  :id<int>        type among int, uint, alpha, alnum, hex and uuid
+//  :kind(a|b)      one of the listed values
+//
+// Several constrained parameters, plus one unconstrained parameter tried last,
+// can be registered for the same position.
+//
+// A named parameter followed by '?' is optional, with the default value given
+// after '?=' if any. The path is registered with and without the segment:
+//  Path: /docs/:version?=v1/page
+//
+//  Requests:
+//   /docs/v2/page                       match: version="v2"
+//   /docs/page                          match: version="v1"
+//
 // Catch-all parameters match anything until the path end, including the
 // directory index (the '/' before the catch-all). Since they match anything
 // until the end, catch-all parameters must always be the final path element.
@@ -64,15 +95,30 @@
 //   /files/templates/article.html       match: filepath="/templates/article.html"
 //   /files                              no match, but the router would redirect
 //
+// The wildcards of the Go 1.22 http.ServeMux syntax are accepted too and
+// converted: {name} into :name, {name...} into *name, and a final {$} is
+// dropped. Both syntaxes can't be mixed in a path. HandlePatternC also takes
+// the method and host of the ServeMux patterns, and matches the patterns
+// without method for any method and the paths ending with a '/' for all the
+// paths under them, like http.ServeMux:
+//  mux.HandlePatternC("GET /items/{id}", GetItem)
+//  mux.HandlePatternC("/static/", Static)
+//
 // The value of parameters is saved as aParams type saved into the context.
 // Parameters can be retrieved by name using xhandler.Param(ctx, name) method:
 //  user := xmux.Param(ctx, "user") // defined by :user or *user
+//
+// The muxer is also a standard http.Handler. Standard handlers registered with
+// Handle or HandleFunc get the parameters from the context of the request:
+//  user := xmux.ParamsFromRequest(r).Get("user")
 package xmux
 
 import (
 	"net/http"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/rs/xhandler"
 
@@ -82,13 +128,14 @@ import (
 // Mux is a xhandler.HandlerC which can be used to dispatch requests to different
 // handler functions via configurable routes
 type Mux struct {
-	trees map[string]*node
+	current atomic.Pointer[table]
 
 	// Enables automatic redirection if the current route can't be matched but a
 	// handler for the path with (without) the trailing slash exists.
 	// For example if /foo/ is requested but a route only exists for /foo, the
 	// client is redirected to /foo with http status code 301 for GET requests
-	// and 307 for all other request methods.
+	// and 307 for all other request methods, unless configured otherwise with
+	// TrailingSlashRedirectCodes.
 	RedirectTrailingSlash bool
 
 	// If enabled, the router tries to fix the current request path, if no
@@ -97,11 +144,47 @@ type Mux struct {
 	// Afterwards the router does a case-insensitive lookup of the cleaned path.
 	// If a handle can be found for this route, the router makes a redirection
 	// to the corrected path with status code 301 for GET requests and 307 for
-	// all other request methods.
+	// all other request methods, unless configured otherwise with
+	// FixedPathRedirectCodes.
 	// For example /FOO and /..//Foo could be redirected to /foo.
 	// RedirectTrailingSlash is independent of this option.
 	RedirectFixedPath bool
 
+	// If enabled, the requests redirected because of RedirectTrailingSlash
+	// or RedirectFixedPath are served directly by the route of the corrected
+	// path instead, saving a round trip to the clients. The handler gets the
+	// corrected path with NormalizedPath(ctx) while the request is left
+	// untouched, and the canonical URL of the request is reported with
+	// CanonicalURL.
+	NormalizePath bool
+
+	// Optional function called with the canonical URL of the requests served
+	// with a corrected path because of NormalizePath, before the handler. If
+	// it is not set, the URL is set in the Content-Location header of the
+	// response.
+	CanonicalURL func(ctx context.Context, w http.ResponseWriter, r *http.Request, url string)
+
+	// If enabled, the requests whose path would be fixed by
+	// RedirectTrailingSlash or RedirectFixedPath but is suspicious are
+	// answered with 400 (Bad Request) instead of being redirected or
+	// normalized. A path is suspicious if it has backslashes, encoded slashes
+	// or backslashes, control characters, or if its fixed path would not be a
+	// same-origin relative URL, like //evil.com. Without this option, such a
+	// fixed path is not used and the other paths are redirected.
+	RejectSuspiciousPaths bool
+
+	// Status codes of the trailing slash and fixed path redirections, for GET
+	// requests and for the other methods. NewPermanent sets them to use 308
+	// for the other methods.
+	TrailingSlashRedirectCodes RedirectCodes
+	FixedPathRedirectCodes     RedirectCodes
+
+	// Optional function writing the redirection responses, called with the
+	// target URL and status code once the Location header is set. It must
+	// write the status code and can write a custom body. If it is not set,
+	// http.Redirect is used.
+	RedirectBody func(ctx context.Context, w http.ResponseWriter, r *http.Request, url string, code int)
+
 	// If enabled, the router checks if another method is allowed for the
 	// current route, if the current request can not be routed.
 	// If this is the case, the request is answered with 'Method Not Allowed'
@@ -110,6 +193,52 @@ type Mux struct {
 	// handler.
 	HandleMethodNotAllowed bool
 
+	// If enabled, the router automatically replies to OPTIONS requests with
+	// status 204 and an Allow header listing the methods registered for the
+	// path. An OPTIONS request for "*" lists all the methods of the router.
+	// Routes registered explicitly for the OPTIONS method take precedence.
+	HandleOPTIONS bool
+
+	// If enabled, HEAD requests for which no HEAD route is registered are
+	// handled by the GET route of the same path. The response body written by
+	// the handler is discarded while headers, including Content-Length, are
+	// kept.
+	HandleHEAD bool
+
+	// If enabled, the parameters of the matched route are also set on the
+	// request with Request.SetPathValue, and Request.Pattern is set to the
+	// route as registered, like /users/:id or "GET /items/{id}", for the
+	// handlers and the libraries reading them. The value of a catch-all
+	// parameter is set without its leading '/', like with http.ServeMux. The
+	// request is modified in place, like the standard http.ServeMux does.
+	SetPathValues bool
+
+	// If enabled, a request path matching no route is looked up again ignoring
+	// the case of the static parts of the routes, and served directly by the
+	// route found, if any, instead of being redirected like with
+	// RedirectFixedPath. For example /Users/Bob is served by the /users/:name
+	// route with name="Bob". The paths matching a route with their exact case
+	// are served without extra cost.
+	CaseInsensitive bool
+
+	// Optional function called on automatic OPTIONS responses before the
+	// status is written. The Allow header is already set and other headers,
+	// like CORS ones, can be added to the header map.
+	OptionsHeader func(ctx context.Context, header http.Header, r *http.Request)
+
+	// Version served to the requests not asking for a version when the path
+	// has versioned routes, see Mux.Version.
+	DefaultVersion string
+
+	// Optional function returning the API version asked by the request. If it
+	// is not set, RequestVersion is used.
+	VersionFunc func(r *http.Request) string
+
+	// Optional function called when the version asked by the request is not
+	// registered for the path, with the versions registered for it. If it is
+	// not set, http.Error with http.StatusNotAcceptable is used.
+	NotAcceptable func(ctx context.Context, w http.ResponseWriter, r *http.Request, versions []string)
+
 	// Configurable http.Handler which is called when no matching route is
 	// found. If it is not set, http.Error with http.StatusNotFound is used.
 	NotFound xhandler.HandlerC
@@ -125,6 +254,15 @@ type Mux struct {
 	// The handler can be used to keep your server from crashing because of
 	// unrecovered panics.
 	PanicHandler func(context.Context, http.ResponseWriter, *http.Request, interface{})
+
+	mws []func(next xhandler.HandlerC) xhandler.HandlerC
+
+	// parent is the muxer holding the options of a host muxer, nil otherwise
+	parent *muxRef
+
+	// mu serializes the updates of the route table
+	mu   sync.Mutex
+	self *muxRef
 }
 
 // ParamHolder holds URL parameters.
@@ -149,7 +287,12 @@ func (ps ParamHolder) Get(name string) string {
 
 type key int
 
-const paramsKey key = iota
+const (
+	paramsKey key = iota
+	outcomeKey
+	outcomeHandlerKey
+	normalizedPathKey
+)
 
 var emptyParams = ParamHolder(nil)
 
@@ -176,6 +319,80 @@ func Param(ctx context.Context, name string) string {
 	return Params(ctx).Get(name)
 }
 
+// ParamsFromRequest returns the URL parameters stored in the context of the
+// request by the http.Handler adapters, like Handle and HandleFunc.
+//
+// This is a shortcut for:
+//   xmux.Params(r.Context())
+func ParamsFromRequest(r *http.Request) ParamHolder {
+	return Params(r.Context())
+}
+
+// Outcome describes how the muxer resolved a request.
+type Outcome uint8
+
+const (
+	// OutcomeUnknown is returned by RouteOutcome when the context was not
+	// created by the muxer.
+	OutcomeUnknown Outcome = iota
+	// OutcomeMatched means the request is handled by a registered route.
+	OutcomeMatched
+	// OutcomeRedirectTrailingSlash means the request is redirected to the same
+	// path with (without) a trailing slash.
+	OutcomeRedirectTrailingSlash
+	// OutcomeRedirectFixedPath means the request is redirected to the cleaned
+	// and case corrected path.
+	OutcomeRedirectFixedPath
+	// OutcomeMethodNotAllowed means the path exists for other methods only.
+	OutcomeMethodNotAllowed
+	// OutcomeNotFound means no route matches the request.
+	OutcomeNotFound
+	// OutcomeOptions means the request is answered by the automatic OPTIONS
+	// response.
+	OutcomeOptions
+	// OutcomeNotAcceptable means the path has versioned routes but none for
+	// the version asked by the request.
+	OutcomeNotAcceptable
+	// OutcomeFallback means no route matches the request, which is served by
+	// the single-page app fallback of its path prefix.
+	OutcomeFallback
+	// OutcomeBadRequest means the path of the request would have been fixed
+	// but is suspicious, see Mux.RejectSuspiciousPaths.
+	OutcomeBadRequest
+)
+
+var outcomeNames = []string{
+	OutcomeUnknown:               "unknown",
+	OutcomeMatched:               "matched",
+	OutcomeRedirectTrailingSlash: "redirect trailing slash",
+	OutcomeRedirectFixedPath:     "redirect fixed path",
+	OutcomeMethodNotAllowed:      "method not allowed",
+	OutcomeNotFound:              "not found",
+	OutcomeOptions:               "options",
+	OutcomeNotAcceptable:         "not acceptable",
+	OutcomeFallback:              "fallback",
+	OutcomeBadRequest:            "bad request",
+}
+
+func (o Outcome) String() string {
+	if int(o) < len(outcomeNames) {
+		return outcomeNames[o]
+	}
+	return outcomeNames[OutcomeUnknown]
+}
+
+// RouteOutcome returns the outcome of the routing stored in context. It is
+// set for middleware registered with Mux.Use and the handlers they wrap.
+func RouteOutcome(ctx context.Context) Outcome {
+	if ctx == nil {
+		return OutcomeUnknown
+	}
+	if o, ok := ctx.Value(outcomeKey).(Outcome); ok {
+		return o
+	}
+	return OutcomeUnknown
+}
+
 // New returns a new muxer instance
 func New() *Mux {
 	return &Mux{
@@ -191,39 +408,68 @@ func (mux *Mux) NewGroup(path string) *Group {
 	return newRouteGroup(mux, path)
 }
 
+// Use appends context-aware middleware to the muxer. Contrary to wrapping the
+// whole muxer, the middleware runs after routing and can thus read both the
+// route parameters and the routing outcome using RouteOutcome. It wraps every
+// response the muxer can produce: matched routes, redirects and the
+// MethodNotAllowed and NotFound handlers.
+//
+// Middleware is applied to routes at registration time, Use must thus be
+// called before any route is registered and panics otherwise.
+func (mux *Mux) Use(mws ...func(next xhandler.HandlerC) xhandler.HandlerC) {
+	mux.update(func(t *table) {
+		if t.hasRoutes() {
+			panic("all middleware must be added before routes are registered")
+		}
+		for _, h := range t.hosts {
+			if h.mux.load().hasRoutes() {
+				panic("all middleware must be added before routes are registered")
+			}
+		}
+		mux.mws = append(mux.mws, mws...)
+		t.outcomeChain = wrap(mux.middleware(), outcomeDispatch)
+		// the host muxers inherit the middleware
+		for _, h := range t.hosts {
+			h.mux.update(func(ht *table) {
+				ht.outcomeChain = wrap(h.mux.middleware(), outcomeDispatch)
+			})
+		}
+	})
+}
+
 // GET is a shortcut for mux.Handle("GET", path, handler)
-func (mux *Mux) GET(path string, handler xhandler.HandlerC) {
-	mux.HandleC("GET", path, handler)
+func (mux *Mux) GET(path string, handler xhandler.HandlerC) *Route {
+	return mux.HandleC("GET", path, handler)
 }
 
 // HEAD is a shortcut for mux.Handle("HEAD", path, handler)
-func (mux *Mux) HEAD(path string, handler xhandler.HandlerC) {
-	mux.HandleC("HEAD", path, handler)
+func (mux *Mux) HEAD(path string, handler xhandler.HandlerC) *Route {
+	return mux.HandleC("HEAD", path, handler)
 }
 
 // OPTIONS is a shortcut for mux.Handle("OPTIONS", path, handler)
-func (mux *Mux) OPTIONS(path string, handler xhandler.HandlerC) {
-	mux.HandleC("OPTIONS", path, handler)
+func (mux *Mux) OPTIONS(path string, handler xhandler.HandlerC) *Route {
+	return mux.HandleC("OPTIONS", path, handler)
 }
 
 // POST is a shortcut for mux.Handle("POST", path, handler)
-func (mux *Mux) POST(path string, handler xhandler.HandlerC) {
-	mux.HandleC("POST", path, handler)
+func (mux *Mux) POST(path string, handler xhandler.HandlerC) *Route {
+	return mux.HandleC("POST", path, handler)
 }
 
 // PUT is a shortcut for mux.Handle("PUT", path, handler)
-func (mux *Mux) PUT(path string, handler xhandler.HandlerC) {
-	mux.HandleC("PUT", path, handler)
+func (mux *Mux) PUT(path string, handler xhandler.HandlerC) *Route {
+	return mux.HandleC("PUT", path, handler)
 }
 
 // PATCH is a shortcut for mux.Handle("PATCH", path, handler)
-func (mux *Mux) PATCH(path string, handler xhandler.HandlerC) {
-	mux.HandleC("PATCH", path, handler)
+func (mux *Mux) PATCH(path string, handler xhandler.HandlerC) *Route {
+	return mux.HandleC("PATCH", path, handler)
 }
 
 // DELETE is a shortcut for mux.Handle("DELETE", path, handler)
-func (mux *Mux) DELETE(path string, handler xhandler.HandlerC) {
-	mux.HandleC("DELETE", path, handler)
+func (mux *Mux) DELETE(path string, handler xhandler.HandlerC) *Route {
+	return mux.HandleC("DELETE", path, handler)
 }
 
 // HandleC registers a net/context aware request handler with the given
@@ -235,55 +481,213 @@ func (mux *Mux) DELETE(path string, handler xhandler.HandlerC) {
 // This function is intended for bulk loading and to allow the usage of less
 // frequently used, non-standardized or custom methods (e.g. for internal
 // communication with a proxy).
-func (mux *Mux) HandleC(method, path string, handler xhandler.HandlerC) {
+//
+// The returned Route can be named to build its URL with Mux.URL. Routes can be
+// registered while the muxer serves requests: the route table is copied on
+// write, each request being served with the table before or after the change.
+func (mux *Mux) HandleC(method, path string, handler xhandler.HandlerC) *Route {
+	return mux.handle(method, path, path, "", false, handler)
+}
+
+// allMethods are the standard methods, routed to the handlers registered for
+// any method.
+var allMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "CONNECT", "OPTIONS", "TRACE"}
+
+// handle registers handler for the method and path, and the version if not
+// empty. The pattern is the route as registered, set as Request.Pattern. An
+// empty method registers the route for any method, and subtree registers it
+// for path and all the paths under it, like the http.ServeMux patterns ending
+// with a '/'.
+func (mux *Mux) handle(method, path, pattern, version string, subtree bool, handler xhandler.HandlerC) *Route {
 	if path[0] != '/' {
 		panic("path must begin with '/' in path '" + path + "'")
 	}
+	path = convertPattern(path)
 
-	if mux.trees == nil {
-		mux.trees = make(map[string]*node)
+	var route *Route
+	mux.update(func(t *table) {
+		if mws := mux.middleware(); len(mws) > 0 {
+			handler = outcomeHandler(OutcomeMatched, wrap(mws, handler))
+		}
+		key, root := method+" "+path, (*node)(nil)
+		if subtree {
+			key, root = key+"*", t.subtree(method)
+		} else {
+			root = t.tree(method)
+		}
+		if version != "" {
+			mux.handleVersion(t, root, key, path, pattern, version, handler)
+		} else {
+			root.addPattern(path, pattern, handler)
+		}
+		route = &Route{ref: mux.ref(), method: method, path: path, subtree: subtree}
+	})
+	return route
+}
+
+// Remove removes the route registered with the given method and path pattern.
+// It returns false if no such route exists, like for one of the paths a
+// pattern with optional parameters expands into: the pattern as registered
+// removes all of them. Like HandleC, it can be called while the muxer serves
+// requests.
+//
+// The routes registered by HandlePatternC for any method have the empty
+// method, and its subtree patterns are removed with a path ending with "/*",
+// as reported by Walk.
+func (mux *Mux) Remove(method, path string) bool {
+	subtree := strings.HasSuffix(path, "/*")
+	if subtree {
+		path = path[:len(path)-1]
+	}
+	path = convertPattern(path)
+	key := method + " " + path
+	trees := mux.load().trees
+	if subtree {
+		key, trees = key+"*", mux.load().subtrees
 	}
+	if root := trees[method]; root == nil {
+		return false
+	}
+	removed := false
+	mux.update(func(t *table) {
+		trees, root := t.trees, (*node)(nil)
+		if subtree {
+			trees, root = t.subtrees, t.subtree(method)
+		} else {
+			root = t.tree(method)
+		}
+		if !root.removeRoute(path) {
+			return
+		}
+		removed = true
+		if root.handler == nil && len(root.children) == 0 {
+			delete(trees, method)
+		}
+		if t.versions[key] != nil {
+			delete(t.writeVersions(), key)
+		}
+		t.names.remove(func(r *Route) bool {
+			return r.method == method && r.path == path && r.subtree == subtree
+		})
+	})
+	return removed
+}
 
-	root := mux.trees[method]
-	if root == nil {
-		root = new(node)
-		mux.trees[method] = root
+// Handle registers a standard http.Handler request handler with the given
+// path and method. The URL parameters are stored in the context of the request
+// passed to the handler, see ParamsFromRequest.
+func (mux *Mux) Handle(method, path string, handler http.Handler) *Route {
+	return mux.HandleC(method, path, httpHandler(handler))
+}
+
+// HandleFunc registers a standard http.HandlerFunc request handler with the given
+// path and method. The URL parameters are stored in the context of the request
+// passed to the handler, see ParamsFromRequest.
+func (mux *Mux) HandleFunc(method, path string, handler http.HandlerFunc) *Route {
+	return mux.HandleC(method, path, httpHandler(handler))
+}
+
+// HandleFuncC registers a standard xhandler.HandlerFuncC request handler with
+// the given path and method.
+func (mux *Mux) HandleFuncC(method, path string, handler xhandler.HandlerFuncC) *Route {
+	return mux.HandleC(method, path, xhandler.HandlerFuncC(handler))
+}
+
+// wrap applies the mws middleware to handler, the first one being the
+// outermost.
+func wrap(mws []func(next xhandler.HandlerC) xhandler.HandlerC, handler xhandler.HandlerC) xhandler.HandlerC {
+	for i := len(mws) - 1; i >= 0; i-- {
+		handler = mws[i](handler)
 	}
+	return handler
+}
 
-	root.addRoute(path, handler)
+// outcomeHandler stores the routing outcome o in the context before calling
+// handler.
+func outcomeHandler(o Outcome, handler xhandler.HandlerC) xhandler.HandlerC {
+	return xhandler.HandlerFuncC(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTPC(context.WithValue(ctx, outcomeKey, o), w, r)
+	})
 }
 
-// Handle regiester a standard http.Handler request handler with the given
-// path and method. With this adapter, your handler won't have access to the
-// context and thus won't work with URL parameters.
-func (mux *Mux) Handle(method, path string, handler http.Handler) {
-	mux.HandleC(method, path,
-		xhandler.HandlerFuncC(func(_ context.Context, w http.ResponseWriter, r *http.Request) {
-			handler.ServeHTTP(w, r)
-		}),
+var methodNotAllowedHandler = xhandler.HandlerFuncC(func(_ context.Context, w http.ResponseWriter, _ *http.Request) {
+	http.Error(w,
+		http.StatusText(http.StatusMethodNotAllowed),
+		http.StatusMethodNotAllowed,
 	)
+})
+
+// optionsHandler returns the automatic OPTIONS response handler.
+func (mux *Mux) optionsHandler() xhandler.HandlerC {
+	return xhandler.HandlerFuncC(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if o := mux.opts(); o.OptionsHeader != nil {
+			o.OptionsHeader(ctx, w.Header(), r)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
 }
 
-// HandleFunc regiester a standard http.HandlerFunc request handler with the given
-// path and method. With this adapter, your handler won't have access to the
-// context and thus won't work with URL parameters.
-func (mux *Mux) HandleFunc(method, path string, handler http.HandlerFunc) {
-	mux.HandleC(method, path,
-		xhandler.HandlerFuncC(func(_ context.Context, w http.ResponseWriter, r *http.Request) {
-			handler(w, r)
-		}),
-	)
+var notFoundHandler = xhandler.HandlerFuncC(func(_ context.Context, w http.ResponseWriter, _ *http.Request) {
+	http.Error(w, "404 page not found", http.StatusNotFound)
+})
+
+// serveOutcome serves a request which did not match a route with handler,
+// wrapped by the muxer's middleware. The middleware chain is built once per
+// route table, handler and the outcome o are passed through it in the context.
+func (mux *Mux) serveOutcome(ctx context.Context, w http.ResponseWriter, r *http.Request, o Outcome, handler xhandler.HandlerC) {
+	if chain := mux.load().outcomeChain; chain != nil {
+		chain.ServeHTTPC(&outcomeContext{Context: ctx, outcome: o, handler: handler}, w, r)
+		return
+	}
+	handler.ServeHTTPC(ctx, w, r)
 }
 
-// HandleFuncC registers a standard xhandler.HandlerFuncC request handler with
-// the given path and method.
-func (mux *Mux) HandleFuncC(method, path string, handler xhandler.HandlerFuncC) {
-	mux.HandleC(method, path, xhandler.HandlerFuncC(handler))
+// outcomeContext holds the outcome of a request which did not match a route
+// and the handler serving it, for the middleware chain of the muxer.
+type outcomeContext struct {
+	context.Context
+	outcome Outcome
+	handler xhandler.HandlerC
+}
+
+func (c *outcomeContext) Value(key interface{}) interface{} {
+	switch key {
+	case outcomeKey:
+		return c.outcome
+	case outcomeHandlerKey:
+		return c.handler
+	}
+	return c.Context.Value(key)
+}
+
+// outcomeDispatch ends the middleware chain of the outcomes by calling the
+// handler stored in the context by serveOutcome.
+var outcomeDispatch = xhandler.HandlerFuncC(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx.Value(outcomeHandlerKey).(xhandler.HandlerC).ServeHTTPC(ctx, w, r)
+})
+
+// httpHandler adapts a standard http.Handler to xhandler.HandlerC. The URL
+// parameters and the normalized path of ctx are stored in the context of the
+// request.
+func httpHandler(handler http.Handler) xhandler.HandlerC {
+	return xhandler.HandlerFuncC(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		rctx := r.Context()
+		if ps := Params(ctx); len(ps) > 0 {
+			rctx = newParamContext(rctx, ps)
+		}
+		if path := NormalizedPath(ctx); path != "" {
+			rctx = context.WithValue(rctx, normalizedPathKey, path)
+		}
+		if rctx != r.Context() {
+			r = r.WithContext(rctx)
+		}
+		handler.ServeHTTP(w, r)
+	})
 }
 
 func (mux *Mux) recv(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 	if rcv := recover(); rcv != nil {
-		mux.PanicHandler(ctx, w, r, rcv)
+		mux.opts().PanicHandler(ctx, w, r, rcv)
 	}
 }
 
@@ -293,93 +697,431 @@ func (mux *Mux) recv(ctx context.Context, w http.ResponseWriter, r *http.Request
 // values. Otherwise the third return value indicates whether a redirection to
 // the same path with an extra / without the trailing slash should be performed.
 func (mux *Mux) Lookup(method, path string) (xhandler.HandlerC, ParamHolder, bool) {
-	if root := mux.trees[method]; root != nil {
+	if root := mux.load().trees[method]; root != nil {
 		return root.getValue(path)
 	}
 	return nil, emptyParams, false
 }
 
+// RouteInfo describes a registered route.
+type RouteInfo struct {
+	// Host is the pattern given to Mux.Host for a route of a host muxer,
+	// empty for the other routes.
+	Host    string
+	Method  string
+	Pattern string
+	// Version is the API version of the route registered with Mux.Version,
+	// empty for an unversioned route.
+	Version string
+	// Handler is the handler as served by the muxer, including middleware
+	// added with Mux.Use or Group.Use.
+	Handler xhandler.HandlerC
+}
+
+// Routes returns all the registered routes, including the routes of the host
+// muxers, sorted by host, method and pattern. Versioned routes are listed once
+// per version, in registration order.
+func (mux *Mux) Routes() []RouteInfo {
+	routes := []RouteInfo{}
+	mux.walk("", func(host, method, pattern string, handler xhandler.HandlerC) error {
+		if vs, ok := handler.(*versionSwitch); ok {
+			for _, v := range vs.versions {
+				routes = append(routes, RouteInfo{Host: host, Method: method, Pattern: pattern, Version: v,
+					Handler: vs.handlers[normalizeVersion(v)]})
+			}
+			return nil
+		}
+		routes = append(routes, RouteInfo{Host: host, Method: method, Pattern: pattern, Handler: handler})
+		return nil
+	})
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Host != routes[j].Host {
+			return routes[i].Host < routes[j].Host
+		}
+		if routes[i].Method != routes[j].Method {
+			return routes[i].Method < routes[j].Method
+		}
+		return routes[i].Pattern < routes[j].Pattern
+	})
+	return routes
+}
+
+// Walk calls fn for each registered route. Methods are walked in alphabetical
+// order and the routes of a method in a stable order, independent of the
+// registration order. The routes registered by HandlePatternC for any method
+// have the empty method, and its subtree patterns end with "/*", like
+// /static/*. The routes of the host muxers are walked next, in the order the
+// hosts are tried, their pattern prefixed with the host pattern as in
+// "api.example.com/users/:id". If fn returns an error, the walk is stopped and
+// the error is returned.
+func (mux *Mux) Walk(fn func(method, pattern string, handler xhandler.HandlerC) error) error {
+	return mux.walk("", func(host, method, pattern string, handler xhandler.HandlerC) error {
+		return fn(method, host+pattern, handler)
+	})
+}
+
+// walk calls fn for the routes of mux, then for the routes of its host
+// muxers.
+func (mux *Mux) walk(host string, fn func(host, method, pattern string, handler xhandler.HandlerC) error) error {
+	t := mux.load()
+	methods := make([]string, 0, len(t.trees))
+	for method := range t.trees {
+		methods = append(methods, method)
+	}
+	for method := range t.subtrees {
+		if t.trees[method] == nil {
+			methods = append(methods, method)
+		}
+	}
+	sort.Strings(methods)
+	for _, method := range methods {
+		if root := t.trees[method]; root != nil {
+			err := root.walk(func(pattern string, handler xhandler.HandlerC) error {
+				return fn(host, method, pattern, handler)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if root := t.subtrees[method]; root != nil {
+			err := root.walk(func(pattern string, handler xhandler.HandlerC) error {
+				return fn(host, method, pattern+"*", handler)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, h := range t.hosts {
+		if err := h.mux.walk(h.pattern, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeHTTP implements http.Handler interface, serving the request with its
+// own context so the muxer can be used without xhandler:
+//  log.Fatal(http.ListenAndServe(":8080", mux))
+func (mux *Mux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	mux.ServeHTTPC(r.Context(), w, r)
+}
+
 // ServeHTTPC implements xhandler.HandlerC interface
 func (mux *Mux) ServeHTTPC(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-	if mux.PanicHandler != nil {
+	o := mux.opts()
+	if o.PanicHandler != nil {
 		defer mux.recv(ctx, w, r)
 	}
 
-	if root := mux.trees[r.Method]; root != nil {
-		path := r.URL.Path
+	// Load the route table once so the request is served by a consistent set
+	// of routes, even if the table is swapped meanwhile
+	t := mux.load()
 
-		if handler, p, tsr := root.getValue(path); handler != nil {
+	// Requests for a host with its own muxer are served by it
+	for _, h := range t.hosts {
+		if p, ok := h.match(r.Host); ok {
 			if len(p) > 0 {
+				if ps := Params(ctx); len(ps) > 0 {
+					p = append(ps[:len(ps):len(ps)], p...)
+				}
 				ctx = newParamContext(ctx, p)
 			}
-			handler.ServeHTTPC(ctx, w, r)
+			h.mux.ServeHTTPC(ctx, w, r)
 			return
-		} else if r.Method != "CONNECT" && path != "/" {
-			code := http.StatusMovedPermanently // Permanent redirect, request with GET method
-			if r.Method != "GET" {
-				// Temporary redirect, request with same method
-				// As of Go 1.3, Go does not support status code 308.
-				code = http.StatusTemporaryRedirect
-			}
+		}
+	}
 
-			if tsr && mux.RedirectTrailingSlash {
-				if len(path) > 1 && path[len(path)-1] == '/' {
-					r.URL.Path = path[:len(path)-1]
-				} else {
-					r.URL.Path = path + "/"
-				}
-				http.Redirect(w, r, r.URL.String(), code)
-				return
-			}
+	// Server-wide OPTIONS request, it can't match any route
+	if r.URL.Path == "*" && r.Method == "OPTIONS" && o.HandleOPTIONS {
+		mux.serveOptions(ctx, w, r, t)
+		return
+	}
 
-			// Try to fix the request path
-			if mux.RedirectFixedPath {
-				fixedPath, found := root.findCaseInsensitivePath(
-					CleanPath(path),
-					mux.RedirectTrailingSlash,
-				)
-				if found {
-					r.URL.Path = string(fixedPath)
-					http.Redirect(w, r, r.URL.String(), code)
-					return
-				}
-			}
+	path := r.URL.Path
+	root := t.trees[r.Method]
+	if r.Method == "HEAD" && o.HandleHEAD {
+		root, w = t.headRoot(root, path, o.CaseInsensitive, w)
+	}
+	// The routes registered for any method come next, after the automatic
+	// OPTIONS responses
+	anyRoot := t.trees[""]
+	if r.Method == "OPTIONS" && o.HandleOPTIONS {
+		anyRoot = nil
+	}
+
+	var tsr, anyTsr bool
+	if root != nil {
+		var leaf *node
+		var p ParamHolder
+		if leaf, p, tsr = root.lookup(path, o.CaseInsensitive); leaf != nil {
+			mux.serveRoute(ctx, w, r, leaf, p)
+			return
+		}
+	}
+	if anyRoot != nil {
+		var leaf *node
+		var p ParamHolder
+		if leaf, p, anyTsr = anyRoot.lookup(path, o.CaseInsensitive); leaf != nil {
+			mux.serveRoute(ctx, w, r, leaf, p)
+			return
+		}
+	}
+	if r.Method != "CONNECT" && path != "/" {
+		if root != nil && mux.serveFixedPath(ctx, w, r, root, tsr) {
+			return
+		}
+		if anyRoot != nil && mux.serveFixedPath(ctx, w, r, anyRoot, anyTsr) {
+			return
 		}
 	}
 
-	// Handle 405
-	if mux.HandleMethodNotAllowed {
-		methods := []string{}
-		for method := range mux.trees {
-			// Skip the requested method - we already tried this one
-			if method == r.Method {
-				continue
-			}
+	// Subtree patterns of http.ServeMux
+	if len(t.subtrees) > 0 && mux.serveSubtree(ctx, w, r, t) {
+		return
+	}
 
-			handler, _, _ := mux.trees[method].getValue(r.URL.Path)
-			if handler != nil {
-				methods = append(methods, method)
-			}
+	if r.Method == "OPTIONS" && o.HandleOPTIONS {
+		if mux.serveOptions(ctx, w, r, t) {
+			return
 		}
-		if len(methods) > 0 && methods[0] != "OPTIONS" {
-			sort.Strings(methods)
+	} else if o.HandleMethodNotAllowed { // Handle 405
+		if methods := mux.allowed(t, r.URL.Path, r.Method); len(methods) > 0 {
 			w.Header().Set("Allow", strings.Join(methods, ", "))
+			handler := xhandler.HandlerC(methodNotAllowedHandler)
 			if mux.MethodNotAllowed != nil {
-				mux.MethodNotAllowed.ServeHTTPC(ctx, w, r)
-			} else {
-				http.Error(w,
-					http.StatusText(http.StatusMethodNotAllowed),
-					http.StatusMethodNotAllowed,
-				)
+				handler = mux.MethodNotAllowed
+			} else if o.MethodNotAllowed != nil {
+				handler = o.MethodNotAllowed
 			}
+			mux.serveOutcome(ctx, w, r, OutcomeMethodNotAllowed, handler)
 			return
 		}
 	}
 
+	// Single-page app fallback
+	if handler := t.fallback(r); handler != nil {
+		mux.serveOutcome(ctx, w, r, OutcomeFallback, handler)
+		return
+	}
+
 	// Handle 404
+	handler := xhandler.HandlerC(notFoundHandler)
 	if mux.NotFound != nil {
-		mux.NotFound.ServeHTTPC(ctx, w, r)
-	} else {
-		http.Error(w, "404 page not found", http.StatusNotFound)
+		handler = mux.NotFound
+	} else if o.NotFound != nil {
+		handler = o.NotFound
+	}
+	mux.serveOutcome(ctx, w, r, OutcomeNotFound, handler)
+}
+
+// serveRoute serves the request with the leaf of the matched route and its
+// parameters ps.
+func (mux *Mux) serveRoute(ctx context.Context, w http.ResponseWriter, r *http.Request, leaf *node, ps ParamHolder) {
+	if len(ps) > 0 {
+		// keep the parameters set by an enclosing muxer, like the host
+		// parameters
+		if p := Params(ctx); len(p) > 0 {
+			ps = append(p[:len(p):len(p)], ps...)
+		}
+		ctx = newParamContext(ctx, ps)
+	}
+	if mux.opts().SetPathValues {
+		setPathValues(r, leaf, ps)
+	}
+	leaf.handler.ServeHTTPC(ctx, w, r)
+}
+
+// setPathValues sets the pattern of the matched route as registered and its
+// parameters on the request, the first of the parameters with the same name
+// winning like with ParamHolder.Get. The value of a catch-all parameter is set
+// without its leading '/', like with http.ServeMux.
+func setPathValues(r *http.Request, leaf *node, ps ParamHolder) {
+	r.Pattern = leaf.route
+	catchAll := ""
+	if i := strings.LastIndex(leaf.pattern, "/*"); i >= 0 {
+		catchAll = leaf.pattern[i+2:]
+	}
+	for i := len(ps) - 1; i >= 0; i-- {
+		value := ps[i].Value
+		if ps[i].Name == catchAll {
+			value = strings.TrimPrefix(value, "/")
+		}
+		r.SetPathValue(ps[i].Name, value)
+	}
+}
+
+// hasRoute tells if the tree of root has a route for path.
+func hasRoute(root *node, path string, fold bool) bool {
+	leaf, _, _ := root.lookup(path, fold)
+	return leaf != nil
+}
+
+// serveSubtree redirects the path of a subtree without its trailing slash, or
+// serves the request with the subtree pattern matching the longest prefix of
+// its path, trying the patterns registered for the method of the request
+// before the ones registered for any method at each prefix. It returns false
+// if no subtree pattern matches.
+func (mux *Mux) serveSubtree(ctx context.Context, w http.ResponseWriter, r *http.Request, t *table) bool {
+	o := mux.opts()
+	methods := []string{r.Method}
+	if r.Method == "HEAD" && o.HandleHEAD {
+		methods = append(methods, "GET")
+	}
+	if r.Method != "OPTIONS" || !o.HandleOPTIONS {
+		methods = append(methods, "")
+	}
+	var roots []*node
+	var rootMethods []string
+	for _, method := range methods {
+		if root := t.subtrees[method]; root != nil {
+			roots = append(roots, root)
+			rootMethods = append(rootMethods, method)
+		}
+	}
+
+	path := r.URL.Path
+	if r.Method != "CONNECT" {
+		// the root of a subtree takes precedence over the shorter subtrees,
+		// like with http.ServeMux
+		for _, root := range roots {
+			if _, _, tsr := root.lookup(path, o.CaseInsensitive); tsr && mux.serveFixedPath(ctx, w, r, root, true) {
+				return true
+			}
+		}
+	}
+	if i, leaf, p := lookupSubtree(roots, path, o.CaseInsensitive); leaf != nil {
+		if rootMethods[i] == "GET" && r.Method == "HEAD" {
+			w = headResponseWriter{w}
+		}
+		mux.serveRoute(ctx, w, r, leaf, p)
+		return true
+	}
+	return false
+}
+
+// lookupSubtree returns the leaf and the parameters of the subtree pattern
+// matching the longest prefix of path ending with a '/', looked up in roots in
+// order for each prefix, and the index of the root it was found in. The leaf
+// is nil if no pattern matches.
+func lookupSubtree(roots []*node, path string, fold bool) (int, *node, ParamHolder) {
+	for end := len(path); end > 0; end-- {
+		if path[end-1] != '/' {
+			continue
+		}
+		for i, root := range roots {
+			if leaf, p, _ := root.lookup(path[:end], fold); leaf != nil {
+				return i, leaf, p
+			}
+		}
+	}
+	return -1, nil, nil
+}
+
+// headRoot returns the tree to use for a HEAD request on path: the HEAD tree
+// root if it has a route for path, the GET tree otherwise. When the GET tree is
+// returned, w is wrapped to discard the response body. The lookups ignore the
+// case of the routes if fold is true.
+func (t *table) headRoot(root *node, path string, fold bool, w http.ResponseWriter) (*node, http.ResponseWriter) {
+	if root != nil {
+		if leaf, _, _ := root.lookup(path, fold); leaf != nil {
+			return root, w
+		}
+	}
+	get := t.trees["GET"]
+	if get == nil {
+		return root, w
+	}
+	if root != nil {
+		if leaf, _, _ := get.lookup(path, fold); leaf == nil {
+			return root, w
+		}
+	}
+	return get, headResponseWriter{w}
+}
+
+// headResponseWriter discards the response body of GET handlers serving HEAD
+// requests.
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w headResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// Flush implements http.Flusher if the underlying writer does.
+func (w headResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (w headResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// serveOptions answers an OPTIONS request with the methods allowed for the
+// requested path. It returns false if the path is unknown.
+func (mux *Mux) serveOptions(ctx context.Context, w http.ResponseWriter, r *http.Request, t *table) bool {
+	methods := mux.allowed(t, r.URL.Path, r.Method)
+	if len(methods) == 0 {
+		return false
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	mux.serveOutcome(ctx, w, r, OutcomeOptions, mux.optionsHandler())
+	return true
+}
+
+// allowed returns the sorted list of methods, other than reqMethod, having a
+// route for path. A path of "*" matches all the methods. The list is empty if
+// OPTIONS is the only method found.
+func (mux *Mux) allowed(t *table, path, reqMethod string) []string {
+	o := mux.opts()
+	found := map[string]bool{}
+	for method, root := range t.trees {
+		if path == "*" || hasRoute(root, path, o.CaseInsensitive) {
+			found[method] = true
+		}
+	}
+	for method, root := range t.subtrees {
+		if _, leaf, _ := lookupSubtree([]*node{root}, path, o.CaseInsensitive); path == "*" || leaf != nil {
+			found[method] = true
+		}
+	}
+	if found[""] {
+		// routes registered for any method
+		for _, method := range allMethods {
+			found[method] = true
+		}
+		delete(found, "")
+	}
+	// Skip the requested method - we already tried this one
+	delete(found, reqMethod)
+	options := o.HandleOPTIONS || found["OPTIONS"]
+	delete(found, "OPTIONS")
+	methods := make([]string, 0, len(found))
+	for method := range found {
+		methods = append(methods, method)
+	}
+	if len(methods) == 0 {
+		return methods
+	}
+	if o.HandleHEAD && reqMethod != "HEAD" {
+		// HEAD is implicitly allowed for GET routes
+		var get, head bool
+		for _, method := range methods {
+			get = get || method == "GET"
+			head = head || method == "HEAD"
+		}
+		if get && !head {
+			methods = append(methods, "HEAD")
+		}
+	}
+	if options {
+		methods = append(methods, "OPTIONS")
 	}
+	sort.Strings(methods)
+	return methods
 }
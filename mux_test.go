@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/rs/xhandler"
 	"github.com/stretchr/testify/assert"
@@ -109,6 +110,160 @@ func TestMuxAdaptors(t *testing.T) {
 	assert.True(t, handleFuncC, "routing failed")
 }
 
+func TestMuxServeHTTP(t *testing.T) {
+	type ctxKey struct{}
+	mux := New()
+	mux.Handle("GET", "/user/:name", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(ParamsFromRequest(r).Get("name") + " " + r.Context().Value(ctxKey{}).(string)))
+	}))
+	mux.HandleFunc("GET", "/static", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fmt.Sprint(len(ParamsFromRequest(r)))))
+	})
+	mux.GET("/ctx/:name", xhandler.HandlerFuncC(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(Param(ctx, "name") + " " + ctx.Value(ctxKey{}).(string)))
+	}))
+
+	// standard middleware wrapping the muxer
+	var h http.Handler = mux
+	h = http.TimeoutHandler(h, time.Second, "timeout")
+	for path, body := range map[string]string{
+		"/user/gopher": "gopher value",
+		"/static":      "0",
+		"/ctx/gopher":  "gopher value",
+	} {
+		r, _ := http.NewRequest("GET", path, nil)
+		r = r.WithContext(context.WithValue(r.Context(), ctxKey{}, "value"))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, 200, w.Code, path)
+		assert.Equal(t, body, w.Body.String(), path)
+	}
+
+	r, _ := http.NewRequest("GET", "/user/gopher", nil)
+	assert.Nil(t, ParamsFromRequest(r))
+}
+
+func TestMuxSetPathValues(t *testing.T) {
+	var r *http.Request
+	handler := http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+		r = req
+	})
+	mux := New()
+	mux.Handle("GET", "/users/:id/files/*path", handler)
+	mux.Handle("GET", "/docs/:page?=index", handler)
+	mux.Handle("GET", "/api/:version?=v1/page", handler)
+	mux.HandlePattern("GET /items/{id}", handler)
+	mux.HandlePattern("/static/{path...}", handler)
+	mux.NewGroup("/orgs/{org}").HandlePattern("GET /repos/{repo}", handler)
+	mux.Host("{tenant}.example.com").Handle("GET", "/users/:id", handler)
+
+	serve := func(path string) {
+		r = nil
+		req, _ := http.NewRequest("GET", path, nil)
+		mux.ServeHTTPC(context.Background(), httptest.NewRecorder(), req)
+	}
+
+	serve("/users/42/files/a/b")
+	if assert.NotNil(t, r) {
+		assert.Equal(t, "", r.Pattern)
+		assert.Equal(t, "", r.PathValue("id"))
+	}
+
+	mux.SetPathValues = true
+	serve("/users/42/files/a/b")
+	if assert.NotNil(t, r) {
+		assert.Equal(t, "/users/:id/files/*path", r.Pattern)
+		assert.Equal(t, "42", r.PathValue("id"))
+		assert.Equal(t, "a/b", r.PathValue("path"))
+	}
+	serve("/docs")
+	if assert.NotNil(t, r) {
+		assert.Equal(t, "/docs/:page?=index", r.Pattern)
+		assert.Equal(t, "index", r.PathValue("page"))
+	}
+	serve("/api/page")
+	if assert.NotNil(t, r) {
+		assert.Equal(t, "/api/:version?=v1/page", r.Pattern)
+		assert.Equal(t, "v1", r.PathValue("version"))
+	}
+	serve("/items/7")
+	if assert.NotNil(t, r) {
+		assert.Equal(t, "GET /items/{id}", r.Pattern)
+		assert.Equal(t, "7", r.PathValue("id"))
+	}
+	serve("/static/css/site.css")
+	if assert.NotNil(t, r) {
+		assert.Equal(t, "/static/{path...}", r.Pattern)
+		assert.Equal(t, "css/site.css", r.PathValue("path"))
+	}
+	serve("/orgs/acme/repos/xmux")
+	if assert.NotNil(t, r) {
+		assert.Equal(t, "GET /orgs/{org}/repos/{repo}", r.Pattern)
+		assert.Equal(t, "acme", r.PathValue("org"))
+		assert.Equal(t, "xmux", r.PathValue("repo"))
+	}
+
+	serve("http://acme.example.com/users/42")
+	if assert.NotNil(t, r) {
+		assert.Equal(t, "/users/:id", r.Pattern)
+		assert.Equal(t, "acme", r.PathValue("tenant"))
+		assert.Equal(t, "42", r.PathValue("id"))
+	}
+}
+
+func TestMuxCaseInsensitive(t *testing.T) {
+	handler := func(s string) xhandler.HandlerC {
+		return xhandler.HandlerFuncC(func(ctx context.Context, w http.ResponseWriter, _ *http.Request) {
+			w.Write([]byte(s))
+			for _, p := range Params(ctx) {
+				w.Write([]byte(" " + p.Name + "=" + p.Value))
+			}
+		})
+	}
+	mux := New()
+	mux.CaseInsensitive = true
+	mux.HandleMethodNotAllowed = true
+	mux.HandleHEAD = true
+	mux.GET("/users/:name", handler("user"))
+	mux.GET("/users/:name/Files/*path", handler("files"))
+	mux.GET("/about", handler("about"))
+	mux.GET("/About", handler("About"))
+	mux.POST("/posts", handler("post"))
+
+	tests := []struct {
+		method, path string
+		code         int
+		body         string
+	}{
+		{"GET", "/users/Bob", 200, "user name=Bob"},
+		{"GET", "/Users/Bob", 200, "user name=Bob"},
+		{"GET", "/USERS/bob/files/Docs/A.txt", 200, "files name=bob path=/Docs/A.txt"},
+		{"HEAD", "/USERS/bob", 200, ""},
+		{"GET", "/about", 200, "about"},
+		{"GET", "/About", 200, "About"},
+		{"GET", "/Users/Bob/", 301, ""},
+		{"GET", "/Posts", 405, "Method Not Allowed\n"},
+		{"GET", "/nope", 404, "404 page not found\n"},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest(tt.method, tt.path, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTPC(context.Background(), w, r)
+		assert.Equal(t, tt.code, w.Code, tt.path)
+		if tt.code != 301 {
+			assert.Equal(t, tt.body, w.Body.String(), tt.path)
+		}
+	}
+
+	// exact case hits cost the same as without the option
+	r, _ := http.NewRequest("GET", "/users/bob", nil)
+	w := new(mockResponseWriter)
+	serve := func() { mux.ServeHTTPC(context.Background(), w, r) }
+	allocs := testing.AllocsPerRun(100, serve)
+	mux.CaseInsensitive = false
+	assert.Equal(t, testing.AllocsPerRun(100, serve), allocs)
+}
+
 type handlerStruct struct {
 	handeled *bool
 }
@@ -383,3 +538,468 @@ func TestMuxLookup(t *testing.T) {
 	assert.Nil(t, handler, "Got handle for unregistered pattern: %v", handler)
 	assert.False(t, tsr, "Got wrong TSR recommendation!")
 }
+
+func TestMuxUse(t *testing.T) {
+	var outcomes []Outcome
+	built := 0
+	handlerFunc := xhandler.HandlerFuncC(func(_ context.Context, _ http.ResponseWriter, _ *http.Request) {})
+
+	mux := New()
+	mux.Use(func(next xhandler.HandlerC) xhandler.HandlerC {
+		built++
+		return xhandler.HandlerFuncC(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			outcomes = append(outcomes, RouteOutcome(ctx))
+			w.Header().Set("X-Middleware", "1")
+			next.ServeHTTPC(ctx, w, r)
+		})
+	})
+	mux.GET("/path", handlerFunc)
+	mux.POST("/post", handlerFunc)
+	mux.GET("/user/:name", xhandler.HandlerFuncC(func(ctx context.Context, _ http.ResponseWriter, _ *http.Request) {
+		assert.Equal(t, "gopher", Param(ctx, "name"))
+	}))
+
+	assert.Panics(t, func() {
+		mux.Use(func(next xhandler.HandlerC) xhandler.HandlerC { return next })
+	})
+	// once for each route and once for the other responses
+	assert.Equal(t, 4, built)
+
+	tests := []struct {
+		route   string
+		code    int
+		outcome Outcome
+	}{
+		{"/path", 200, OutcomeMatched},
+		{"/user/gopher", 200, OutcomeMatched},
+		{"/path/", 301, OutcomeRedirectTrailingSlash},
+		{"/PATH", 301, OutcomeRedirectFixedPath},
+		{"/post", 405, OutcomeMethodNotAllowed},
+		{"/nope", 404, OutcomeNotFound},
+	}
+	for _, tt := range tests {
+		outcomes = nil
+		r, _ := http.NewRequest("GET", tt.route, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTPC(context.Background(), w, r)
+		assert.Equal(t, tt.code, w.Code, tt.route)
+		assert.Equal(t, []Outcome{tt.outcome}, outcomes, tt.route)
+		assert.Equal(t, "1", w.Header().Get("X-Middleware"), tt.route)
+	}
+	assert.Equal(t, 4, built, "middleware built per request")
+	assert.Equal(t, OutcomeUnknown, RouteOutcome(context.Background()))
+	assert.Equal(t, "not found", OutcomeNotFound.String())
+}
+
+func TestMuxOPTIONS(t *testing.T) {
+	handlerFunc := xhandler.HandlerFuncC(func(_ context.Context, _ http.ResponseWriter, _ *http.Request) {})
+
+	mux := New()
+	mux.POST("/path", handlerFunc)
+	mux.GET("/path", handlerFunc)
+	mux.PUT("/other", handlerFunc)
+
+	// Disabled by default
+	r, _ := http.NewRequest("OPTIONS", "/path", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTPC(context.Background(), w, r)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	mux.HandleOPTIONS = true
+	w = httptest.NewRecorder()
+	mux.ServeHTTPC(context.Background(), w, r)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "GET, OPTIONS, POST", w.Header().Get("Allow"))
+
+	// Server-wide
+	r, _ = http.NewRequest("OPTIONS", "*", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTPC(context.Background(), w, r)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "GET, OPTIONS, POST, PUT", w.Header().Get("Allow"))
+
+	// Unknown path
+	r, _ = http.NewRequest("OPTIONS", "/nope", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTPC(context.Background(), w, r)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// 405 lists OPTIONS
+	r, _ = http.NewRequest("DELETE", "/path", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTPC(context.Background(), w, r)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET, OPTIONS, POST", w.Header().Get("Allow"))
+
+	// Header hook
+	mux.OptionsHeader = func(ctx context.Context, h http.Header, r *http.Request) {
+		h.Set("Access-Control-Allow-Methods", h.Get("Allow"))
+	}
+	r, _ = http.NewRequest("OPTIONS", "/other", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTPC(context.Background(), w, r)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "OPTIONS, PUT", w.Header().Get("Access-Control-Allow-Methods"))
+
+	// Explicit route takes precedence
+	custom := false
+	mux.OPTIONS("/path", xhandler.HandlerFuncC(func(_ context.Context, w http.ResponseWriter, _ *http.Request) {
+		custom = true
+		w.WriteHeader(http.StatusOK)
+	}))
+	r, _ = http.NewRequest("OPTIONS", "/path", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTPC(context.Background(), w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, custom)
+}
+
+func TestMuxHEAD(t *testing.T) {
+	mux := New()
+	mux.GET("/user/:name", xhandler.HandlerFuncC(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		body := "hello " + Param(ctx, "name")
+		w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+		w.Write([]byte(body))
+	}))
+	mux.POST("/post", xhandler.HandlerFuncC(func(_ context.Context, _ http.ResponseWriter, _ *http.Request) {}))
+
+	// Disabled by default
+	r, _ := http.NewRequest("HEAD", "/user/gopher", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTPC(context.Background(), w, r)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET", w.Header().Get("Allow"))
+
+	mux.HandleHEAD = true
+	w = httptest.NewRecorder()
+	mux.ServeHTTPC(context.Background(), w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "12", w.Header().Get("Content-Length"))
+	assert.Equal(t, "", w.Body.String())
+
+	// Trailing slash redirect uses the GET routes
+	r, _ = http.NewRequest("HEAD", "/user/gopher/", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTPC(context.Background(), w, r)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "/user/gopher", w.Header().Get("Location"))
+
+	// 405 lists HEAD
+	r, _ = http.NewRequest("PUT", "/user/gopher", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTPC(context.Background(), w, r)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET, HEAD", w.Header().Get("Allow"))
+
+	// Explicit HEAD routes take precedence, other paths still fall back to GET
+	head := false
+	mux.HEAD("/head", xhandler.HandlerFuncC(func(_ context.Context, _ http.ResponseWriter, _ *http.Request) {
+		head = true
+	}))
+	r, _ = http.NewRequest("HEAD", "/head", nil)
+	mux.ServeHTTPC(context.Background(), httptest.NewRecorder(), r)
+	assert.True(t, head)
+	r, _ = http.NewRequest("HEAD", "/user/gopher", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTPC(context.Background(), w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "", w.Body.String())
+
+	// The underlying writer is reachable by the GET handlers
+	mux.GET("/stream", xhandler.HandlerFuncC(func(_ context.Context, w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("data"))
+		assert.NoError(t, http.NewResponseController(w).Flush())
+	}))
+	r, _ = http.NewRequest("HEAD", "/stream", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTPC(context.Background(), w, r)
+	assert.True(t, w.Flushed)
+	assert.Equal(t, "", w.Body.String())
+}
+
+func TestMuxRoutes(t *testing.T) {
+	handlerFunc := xhandler.HandlerFuncC(func(_ context.Context, _ http.ResponseWriter, _ *http.Request) {})
+
+	mux := New()
+	assert.Equal(t, []RouteInfo{}, mux.Routes())
+
+	mux.POST("/users", handlerFunc)
+	mux.GET("/users/:id", handlerFunc)
+	mux.GET("/users", handlerFunc)
+	mux.GET("/", handlerFunc)
+	mux.GET("/src/*filepath", handlerFunc)
+	mux.GET("/docs/:version?=v1/page", handlerFunc)
+	api := mux.NewGroup("/api/:version")
+	api.DELETE("/items/:id", handlerFunc)
+	api.GET("/items", handlerFunc)
+
+	want := []string{
+		"DELETE /api/:version/items/:id",
+		"GET /",
+		"GET /api/:version/items",
+		"GET /docs/:version?=v1/page",
+		"GET /src/*filepath",
+		"GET /users",
+		"GET /users/:id",
+		"POST /users",
+	}
+	routes := mux.Routes()
+	got := make([]string, 0, len(routes))
+	for _, r := range routes {
+		assert.NotNil(t, r.Handler)
+		got = append(got, r.Method+" "+r.Pattern)
+	}
+	assert.Equal(t, want, got)
+
+	var walked []string
+	err := mux.Walk(func(method, pattern string, handler xhandler.HandlerC) error {
+		walked = append(walked, method+" "+pattern)
+		if len(walked) == 3 {
+			return fmt.Errorf("stop")
+		}
+		return nil
+	})
+	assert.EqualError(t, err, "stop")
+	assert.Len(t, walked, 3)
+	assert.Equal(t, "DELETE /api/:version/items/:id", walked[0])
+}
+
+func TestMuxConstraints(t *testing.T) {
+	var routed string
+	handler := func(route string) xhandler.HandlerFuncC {
+		return func(ctx context.Context, _ http.ResponseWriter, _ *http.Request) {
+			routed = route + " " + Param(ctx, "id")
+		}
+	}
+
+	mux := New()
+	mux.GET("/users/:id<int>", handler("int"))
+	mux.GET("/users/:id{[a-z]+}", handler("regexp"))
+	mux.GET("/kinds/:id(a|b)", handler("enum"))
+
+	for path, want := range map[string]string{
+		"/users/42":  "int 42",
+		"/users/-42": "int -42",
+		"/users/bob": "regexp bob",
+		"/kinds/b":   "enum b",
+	} {
+		routed = ""
+		r, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTPC(context.Background(), w, r)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		assert.Equal(t, want, routed, path)
+	}
+
+	for _, path := range []string{"/users/Bob", "/users/4b", "/kinds/c"} {
+		routed = ""
+		r, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTPC(context.Background(), w, r)
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+		assert.Equal(t, "", routed, path)
+	}
+}
+
+func TestMuxOptional(t *testing.T) {
+	var version string
+	mux := New()
+	mux.GET("/docs/:version?=v1/page", xhandler.HandlerFuncC(func(ctx context.Context, _ http.ResponseWriter, _ *http.Request) {
+		version = Param(ctx, "version")
+	}))
+
+	for path, want := range map[string]string{
+		"/docs/v2/page": "v2",
+		"/docs/page":    "v1",
+	} {
+		version = ""
+		r, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTPC(context.Background(), w, r)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		assert.Equal(t, want, version, path)
+	}
+
+	for path, want := range map[string]string{
+		"/docs/v2/page/": "/docs/v2/page",
+		"/docs/page/":    "/docs/page",
+	} {
+		r, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTPC(context.Background(), w, r)
+		assert.Equal(t, http.StatusMovedPermanently, w.Code, path)
+		assert.Equal(t, want, w.Header().Get("Location"), path)
+	}
+
+	assert.True(t, mux.Remove("GET", "/docs/:version?=v1/page"))
+	_, found := mux.load().trees["GET"]
+	assert.False(t, found, "variants not removed")
+}
+
+func TestMuxRemove(t *testing.T) {
+	handlerFunc := xhandler.HandlerFuncC(func(_ context.Context, _ http.ResponseWriter, _ *http.Request) {})
+
+	mux := New()
+	mux.GET("/users/:id", handlerFunc).Name("user.show")
+	mux.GET("/users", handlerFunc)
+	mux.POST("/users", handlerFunc)
+	mux.GET("/docs/:version?=v1/page", handlerFunc).Name("docs")
+
+	assert.True(t, mux.Remove("GET", "/users/:id"))
+	assert.False(t, mux.Remove("GET", "/users/:id"))
+	assert.False(t, mux.Remove("PUT", "/users"))
+	handler, _, _ := mux.Lookup("GET", "/users/1")
+	assert.Nil(t, handler)
+	_, err := mux.URL("user.show", "id", "1")
+	assert.Error(t, err)
+
+	// only the registered pattern removes the variants of an optional route
+	assert.False(t, mux.Remove("GET", "/docs/page"))
+	assert.False(t, mux.Remove("GET", "/docs/:version/page"))
+	_, err = mux.URL("docs")
+	assert.NoError(t, err)
+	assert.True(t, mux.Remove("GET", "/docs/:version?=v1/page"))
+	_, err = mux.URL("docs")
+	assert.Error(t, err)
+
+	assert.True(t, mux.Remove("POST", "/users"))
+	_, found := mux.load().trees["POST"]
+	assert.False(t, found, "empty method tree not dropped")
+
+	r, _ := http.NewRequest("POST", "/users", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTPC(context.Background(), w, r)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET", w.Header().Get("Allow"))
+}
+
+func TestMuxSwap(t *testing.T) {
+	handler := func(name string) xhandler.HandlerC {
+		return xhandler.HandlerFuncC(func(_ context.Context, w http.ResponseWriter, _ *http.Request) {
+			w.Write([]byte(name))
+		})
+	}
+	serve := func(mux *Mux, path string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTPC(context.Background(), w, r)
+		return w
+	}
+
+	mux := New()
+	mux.GET("/old", handler("old")).Name("page")
+
+	staging := New()
+	staging.GET("/new", handler("new")).Name("page")
+	later := staging.GET("/later/:id", handler("later"))
+	staging.Version("v1").GET("/items", handler("items v1"))
+	staging.DefaultVersion = "v2"
+	mux.DefaultVersion = "v1"
+	mux.Swap(staging)
+
+	assert.Equal(t, http.StatusNotFound, serve(mux, "/old").Code)
+	assert.Equal(t, "new", serve(mux, "/new").Body.String())
+	url, err := mux.URL("page")
+	assert.NoError(t, err)
+	assert.Equal(t, "/new", url)
+
+	// The moved routes belong to mux
+	later.Name("later")
+	url, err = mux.URL("later", "id", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "/later/1", url)
+	_, err = staging.URL("later", "id", "1")
+	assert.Error(t, err)
+	assert.Equal(t, "items v1", serve(mux, "/items").Body.String())
+
+	// The routes are moved out of staging
+	assert.Equal(t, http.StatusNotFound, serve(staging, "/new").Code)
+	staging.GET("/other", handler("other"))
+	assert.Equal(t, http.StatusNotFound, serve(mux, "/other").Code)
+}
+
+func TestMuxUpdateConcurrent(t *testing.T) {
+	handlerFunc := xhandler.HandlerFuncC(func(_ context.Context, _ http.ResponseWriter, _ *http.Request) {})
+	mux := New()
+	mux.GET("/path", handlerFunc)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			path := fmt.Sprintf("/path/%d", i)
+			mux.GET(path, handlerFunc).Name(path)
+			mux.Version("v1").GET(path+"/v", handlerFunc)
+			mux.Version("v2").GET(path+"/v", handlerFunc)
+			if i%2 == 0 {
+				mux.Remove("GET", path)
+			}
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		r, _ := http.NewRequest("GET", "/path", nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTPC(context.Background(), w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	<-done
+
+	assert.Len(t, mux.Routes(), 1+50+2*100)
+	handler, _, _ := mux.Lookup("GET", "/path/3")
+	assert.NotNil(t, handler)
+	handler, _, _ = mux.Lookup("GET", "/path/4")
+	assert.Nil(t, handler)
+}
+
+func TestMuxSwapConcurrent(t *testing.T) {
+	handlerFunc := xhandler.HandlerFuncC(func(_ context.Context, _ http.ResponseWriter, _ *http.Request) {})
+	mux := New()
+	mux.GET("/path", handlerFunc)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			staging := New()
+			staging.GET("/path", handlerFunc)
+			staging.GET(fmt.Sprintf("/path/%d", i), handlerFunc)
+			mux.Swap(staging)
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		r, _ := http.NewRequest("GET", "/path", nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTPC(context.Background(), w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	<-done
+}
+
+func TestMuxSwapBothWays(t *testing.T) {
+	a, b := New(), New()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			a.Swap(b)
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		b.Swap(a)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a.Swap(b) and b.Swap(a) deadlocked")
+	}
+}
+
+func BenchmarkMuxNamedRoutes(b *testing.B) {
+	handler := xhandler.HandlerFuncC(func(_ context.Context, _ http.ResponseWriter, _ *http.Request) {})
+	for i := 0; i < b.N; i++ {
+		mux := New()
+		for j := 0; j < 4000; j++ {
+			mux.GET(fmt.Sprintf("/items%d/:id", j), handler).Name(fmt.Sprintf("item%d", j))
+		}
+	}
+}
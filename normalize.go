@@ -0,0 +1,37 @@
+package xmux
+
+import (
+	"net/http"
+
+	"context"
+)
+
+// NormalizedPath returns the path a request was served with when it was
+// corrected because of Mux.NormalizePath, or an empty string if the request
+// was served with its own path. Standard handlers registered with Handle or
+// HandleFunc get it with NormalizedPath(r.Context()).
+func NormalizedPath(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	path, _ := ctx.Value(normalizedPathKey).(string)
+	return path
+}
+
+// serveNormalized serves the request with the route of the corrected path of
+// root, if any, canonical being the URL of this path. It returns false if no
+// route matches path.
+func (mux *Mux) serveNormalized(ctx context.Context, w http.ResponseWriter, r *http.Request, root *node, path, canonical string) bool {
+	leaf, ps, _ := root.find(path, nil)
+	if leaf == nil {
+		return false
+	}
+	if o := mux.opts(); o.CanonicalURL != nil {
+		o.CanonicalURL(ctx, w, r, canonical)
+	} else {
+		w.Header().Set("Content-Location", canonical)
+	}
+	ctx = context.WithValue(ctx, normalizedPathKey, path)
+	mux.serveRoute(ctx, w, r, leaf, ps)
+	return true
+}
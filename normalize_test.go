@@ -0,0 +1,88 @@
+package xmux
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"context"
+
+	"github.com/rs/xhandler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMuxNormalizePath(t *testing.T) {
+	handler := xhandler.HandlerFuncC(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte(Param(ctx, "id") + " " + NormalizedPath(ctx) + " " + r.URL.Path + " " + string(body)))
+	})
+	mux := New()
+	mux.NormalizePath = true
+	mux.POST("/items", handler)
+	mux.GET("/items/:id/", handler)
+	mux.GET("/docs/*path", handler)
+
+	tests := []struct {
+		method, path string
+		body         string
+		location     string
+	}{
+		{"POST", "/items", "  /items data", ""},
+		{"POST", "/items/", " /items /items/ data", "/items"},
+		{"POST", "/docs/..//items", " /items /docs/..//items data", "/items"},
+		{"POST", "/./ITEMS?q=1", " /items /./ITEMS data", "/items?q=1"},
+		{"GET", "/items/42", "42 /items/42/ /items/42 data", "/items/42/"},
+		{"GET", "/items/../items/Ab//", "Ab /items/Ab/ /items/../items/Ab// data", "/items/Ab/"},
+		{"GET", "/docs", " /docs/ /docs data", "/docs/"},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest(tt.method, tt.path, strings.NewReader("data"))
+		w := httptest.NewRecorder()
+		mux.ServeHTTPC(context.Background(), w, r)
+		assert.Equal(t, http.StatusOK, w.Code, tt.path)
+		assert.Equal(t, tt.body, w.Body.String(), tt.path)
+		assert.Equal(t, tt.location, w.Header().Get("Content-Location"), tt.path)
+	}
+
+	// the corrections turned off are not applied
+	mux.RedirectFixedPath = false
+	r, _ := http.NewRequest("GET", "/ITEMS/42/", http.NoBody)
+	w := httptest.NewRecorder()
+	mux.ServeHTTPC(context.Background(), w, r)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	var canonical string
+	mux.CanonicalURL = func(_ context.Context, w http.ResponseWriter, _ *http.Request, url string) {
+		canonical = url
+		w.Header().Set("Link", "<"+url+">; rel=\"canonical\"")
+	}
+	r, _ = http.NewRequest("GET", "/items/42?a=b", http.NoBody)
+	w = httptest.NewRecorder()
+	mux.ServeHTTPC(context.Background(), w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "/items/42/?a=b", canonical)
+	assert.Equal(t, "", w.Header().Get("Content-Location"))
+	assert.Equal(t, `</items/42/?a=b>; rel="canonical"`, w.Header().Get("Link"))
+}
+
+func TestMuxNormalizePathHandler(t *testing.T) {
+	mux := New()
+	mux.NormalizePath = true
+	mux.HandleFunc("GET", "/users/:name/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(ParamsFromRequest(r).Get("name") + " " + NormalizedPath(r.Context())))
+	})
+
+	for path, body := range map[string]string{
+		"/users/gopher/":  "gopher ",
+		"/users/gopher":   "gopher /users/gopher/",
+		"/USERS//gopher/": "gopher /users/gopher/",
+	} {
+		r, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		assert.Equal(t, body, w.Body.String(), path)
+	}
+}
@@ -0,0 +1,116 @@
+package xmux
+
+import "strings"
+
+// maxOptionalParams is the maximum number of optional parameters of a path.
+const maxOptionalParams = 8
+
+// routeVariant is one of the paths an optional parameter path expands into,
+// with the default values of the parameters it omits.
+type routeVariant struct {
+	path     string
+	defaults ParamHolder
+}
+
+// optionalParam is an optional parameter segment of a path.
+type optionalParam struct {
+	// start and end of the segment, including its leading '/'
+	start, end int
+	// wildcard is the parameter with its constraint, without the '?' marker
+	wildcard string
+	name     string
+	// def is the default value, empty if none
+	def    string
+	hasDef bool
+}
+
+// expandOptional expands the path into its variants with and without each of
+// its optional parameters, written :name? or :name?=default. Consecutive
+// optional parameters are filled from the left: /:a?/:b? expands into /:a/:b,
+// /:a and /, but not into /:b. A path without optional parameters is returned
+// as the single variant.
+func expandOptional(path string) []routeVariant {
+	var opts []optionalParam
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c != ':' && c != '*' {
+			continue
+		}
+		nameEnd, end := wildcardEnd(path, i)
+		if end < 0 {
+			// left to insertChild to report
+			return []routeVariant{{path: path}}
+		}
+		if c == '*' {
+			if strings.HasSuffix(path[i:end], "?") {
+				panic("catch-all parameters can't be optional in path '" + path + "'")
+			}
+		} else if end < len(path) && path[end] == '?' {
+			segEnd := end
+			for segEnd < len(path) && path[segEnd] != '/' {
+				segEnd++
+			}
+			if i == 0 || path[i-1] != '/' {
+				panic("optional parameters must span a whole path segment in path '" + path + "'")
+			}
+			opt := optionalParam{
+				start:    i - 1,
+				end:      segEnd,
+				wildcard: path[i:end],
+				name:     path[i+1 : nameEnd],
+			}
+			if def := path[end+1 : segEnd]; def != "" {
+				if def[0] != '=' {
+					panic("invalid optional parameter '" + path[i:segEnd] + "' in path '" + path + "'")
+				}
+				opt.def, opt.hasDef = def[1:], true
+			}
+			opts = append(opts, opt)
+			end = segEnd
+		}
+		i = end - 1
+	}
+	if len(opts) == 0 {
+		return []routeVariant{{path: path}}
+	}
+	if len(opts) > maxOptionalParams {
+		panic("too many optional parameters in path '" + path + "'")
+	}
+
+	var variants []routeVariant
+	// the bits of omit tell which optional parameters are left out, starting
+	// from the variant with all of them
+variants:
+	for omit := 0; omit < 1<<len(opts); omit++ {
+		var v routeVariant
+		buf := make([]byte, 0, len(path))
+		prev, omitted := 0, false
+		for j, opt := range opts {
+			if opt.start > prev {
+				omitted = false
+			}
+			buf = append(buf, path[prev:opt.start]...)
+			prev = opt.end
+			if omit&(1<<j) != 0 {
+				omitted = true
+				if opt.hasDef {
+					v.defaults = append(v.defaults, Parameter{Name: opt.name, Value: opt.def})
+				}
+				continue
+			}
+			if omitted {
+				// a parameter can't be present after an omitted one
+				continue variants
+			}
+			buf = append(buf, '/')
+			buf = append(buf, opt.wildcard...)
+		}
+		buf = append(buf, path[prev:]...)
+		if len(buf) == 0 {
+			buf = append(buf, '/')
+		}
+		v.path = string(buf)
+		variants = append(variants, v)
+	}
+	return variants
+}
@@ -0,0 +1,182 @@
+package xmux
+
+import (
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// ErrMissingParam is the error wrapped by a ParamError when the parameter is
+// not present in the ParamHolder.
+var ErrMissingParam = errors.New("missing parameter")
+
+// ParamError is returned by the typed accessors of ParamHolder when a
+// parameter is missing or its value can't be converted to the requested type.
+// A single error handler can check for it with errors.As to reply with a
+// 400 (Bad Request).
+type ParamError struct {
+	// Name is the name of the parameter.
+	Name string
+	// Value is the value of the parameter, empty if it is missing.
+	Value string
+	// Type is the type the value was converted to (int, bool, uuid...).
+	Type string
+	// Err is the underlying error, ErrMissingParam if the parameter is
+	// missing.
+	Err error
+}
+
+func (e *ParamError) Error() string {
+	if e.Err == ErrMissingParam {
+		return "missing parameter '" + e.Name + "'"
+	}
+	return "invalid " + e.Type + " value '" + e.Value + "' for parameter '" + e.Name + "'"
+}
+
+// Unwrap returns the underlying error.
+func (e *ParamError) Unwrap() error {
+	return e.Err
+}
+
+// Lookup returns the value of the first Param which key matches the given
+// name. The returned bool tells if the parameter was found, so a missing
+// parameter can be told apart from an empty one.
+func (ps ParamHolder) Lookup(name string) (string, bool) {
+	for _, h := range ps {
+		if h.Name == name {
+			return h.Value, true
+		}
+	}
+	return "", false
+}
+
+// Has tells if a parameter with the given name exists.
+func (ps ParamHolder) Has(name string) bool {
+	_, found := ps.Lookup(name)
+	return found
+}
+
+// At returns the i-th parameter in the order of the route pattern. The
+// returned bool is false if i is out of range.
+func (ps ParamHolder) At(i int) (Parameter, bool) {
+	if i < 0 || i >= len(ps) {
+		return Parameter{}, false
+	}
+	return ps[i], true
+}
+
+// Map returns the parameters as a map of names to values. If several
+// parameters share a name, the first one is kept like with Get.
+func (ps ParamHolder) Map() map[string]string {
+	m := make(map[string]string, len(ps))
+	for i := len(ps) - 1; i >= 0; i-- {
+		m[ps[i].Name] = ps[i].Value
+	}
+	return m
+}
+
+// Int returns the value of the named parameter parsed as a base 10 int.
+func (ps ParamHolder) Int(name string) (int, error) {
+	v, err := ps.parseInt(name, "int", strconv.IntSize)
+	return int(v), err
+}
+
+// Int64 returns the value of the named parameter parsed as a base 10 int64.
+func (ps ParamHolder) Int64(name string) (int64, error) {
+	return ps.parseInt(name, "int64", 64)
+}
+
+// Uint returns the value of the named parameter parsed as a base 10 uint.
+func (ps ParamHolder) Uint(name string) (uint, error) {
+	s, err := ps.lookup(name, "uint")
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseUint(s, 10, strconv.IntSize)
+	if err != nil {
+		return 0, &ParamError{Name: name, Value: s, Type: "uint", Err: err}
+	}
+	return uint(v), nil
+}
+
+// Bool returns the value of the named parameter parsed with strconv.ParseBool.
+func (ps ParamHolder) Bool(name string) (bool, error) {
+	s, err := ps.lookup(name, "bool")
+	if err != nil {
+		return false, err
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, &ParamError{Name: name, Value: s, Type: "bool", Err: err}
+	}
+	return v, nil
+}
+
+// Float64 returns the value of the named parameter parsed as a float64.
+func (ps ParamHolder) Float64(name string) (float64, error) {
+	s, err := ps.lookup(name, "float64")
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, &ParamError{Name: name, Value: s, Type: "float64", Err: err}
+	}
+	return v, nil
+}
+
+// UUID returns the value of the named parameter parsed as an UUID in its
+// canonical 8-4-4-4-12 hex form. The result can be converted to the UUID type
+// of most UUID packages.
+func (ps ParamHolder) UUID(name string) ([16]byte, error) {
+	var u [16]byte
+	s, err := ps.lookup(name, "uuid")
+	if err != nil {
+		return u, err
+	}
+	if !isUUID(s) {
+		return u, &ParamError{Name: name, Value: s, Type: "uuid", Err: errors.New("invalid UUID format")}
+	}
+	b := []byte(s[:8] + s[9:13] + s[14:18] + s[19:23] + s[24:])
+	if _, err := hex.Decode(u[:], b); err != nil {
+		return u, &ParamError{Name: name, Value: s, Type: "uuid", Err: err}
+	}
+	return u, nil
+}
+
+// Time returns the value of the named parameter parsed with time.Parse and the
+// given layout.
+func (ps ParamHolder) Time(name, layout string) (time.Time, error) {
+	s, err := ps.lookup(name, "time")
+	if err != nil {
+		return time.Time{}, err
+	}
+	v, err := time.Parse(layout, s)
+	if err != nil {
+		return time.Time{}, &ParamError{Name: name, Value: s, Type: "time", Err: err}
+	}
+	return v, nil
+}
+
+// lookup returns the value of the named parameter or a ParamError if it is
+// missing.
+func (ps ParamHolder) lookup(name, typ string) (string, error) {
+	s, found := ps.Lookup(name)
+	if !found {
+		return "", &ParamError{Name: name, Type: typ, Err: ErrMissingParam}
+	}
+	return s, nil
+}
+
+func (ps ParamHolder) parseInt(name, typ string, bitSize int) (int64, error) {
+	s, err := ps.lookup(name, typ)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseInt(s, 10, bitSize)
+	if err != nil {
+		return 0, &ParamError{Name: name, Value: s, Type: typ, Err: err}
+	}
+	return v, nil
+}
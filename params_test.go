@@ -0,0 +1,98 @@
+package xmux
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParamsLookup(t *testing.T) {
+	ps := ParamHolder{
+		{"id", "42"},
+		{"empty", ""},
+		{"id", "43"},
+	}
+
+	v, found := ps.Lookup("id")
+	assert.True(t, found)
+	assert.Equal(t, "42", v)
+	v, found = ps.Lookup("empty")
+	assert.True(t, found)
+	assert.Equal(t, "", v)
+	_, found = ps.Lookup("missing")
+	assert.False(t, found)
+
+	assert.True(t, ps.Has("empty"))
+	assert.False(t, ps.Has("missing"))
+
+	assert.Equal(t, map[string]string{"id": "42", "empty": ""}, ps.Map())
+
+	p, found := ps.At(2)
+	assert.True(t, found)
+	assert.Equal(t, Parameter{"id", "43"}, p)
+	_, found = ps.At(3)
+	assert.False(t, found)
+	_, found = ps.At(-1)
+	assert.False(t, found)
+}
+
+func TestParamsTyped(t *testing.T) {
+	ps := ParamHolder{
+		{"int", "-42"},
+		{"uint", "42"},
+		{"bool", "true"},
+		{"float", "1.5"},
+		{"uuid", "6BA7B810-9dad-11d1-80b4-00c04fd430c8"},
+		{"time", "2016-01-02"},
+		{"bad", "x"},
+	}
+
+	i, err := ps.Int("int")
+	assert.NoError(t, err)
+	assert.Equal(t, -42, i)
+	i64, err := ps.Int64("int")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-42), i64)
+	u, err := ps.Uint("uint")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(42), u)
+	b, err := ps.Bool("bool")
+	assert.NoError(t, err)
+	assert.True(t, b)
+	f, err := ps.Float64("float")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.5, f)
+	id, err := ps.UUID("uuid")
+	assert.NoError(t, err)
+	assert.Equal(t, [16]byte{0x6b, 0xa7, 0xb8, 0x10, 0x9d, 0xad, 0x11, 0xd1, 0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8}, id)
+	tm, err := ps.Time("time", "2006-01-02")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2016, 1, 2, 0, 0, 0, 0, time.UTC), tm)
+
+	for typ, get := range map[string]func(name string) error{
+		"int":     func(name string) error { _, err := ps.Int(name); return err },
+		"int64":   func(name string) error { _, err := ps.Int64(name); return err },
+		"uint":    func(name string) error { _, err := ps.Uint(name); return err },
+		"bool":    func(name string) error { _, err := ps.Bool(name); return err },
+		"float64": func(name string) error { _, err := ps.Float64(name); return err },
+		"uuid":    func(name string) error { _, err := ps.UUID(name); return err },
+		"time":    func(name string) error { _, err := ps.Time(name, time.RFC3339); return err },
+	} {
+		err := get("bad")
+		var perr *ParamError
+		if assert.True(t, errors.As(err, &perr), typ) {
+			assert.Equal(t, ParamError{Name: "bad", Value: "x", Type: typ, Err: perr.Err}, *perr)
+			assert.Equal(t, "invalid "+typ+" value 'x' for parameter 'bad'", err.Error())
+		}
+
+		err = get("missing")
+		assert.True(t, errors.Is(err, ErrMissingParam), typ)
+		assert.Equal(t, "missing parameter 'missing'", err.Error())
+	}
+
+	_, err = ParamHolder{{"int", "-1"}}.Uint("int")
+	assert.True(t, errors.Is(err, strconv.ErrSyntax))
+}
@@ -0,0 +1,149 @@
+package xmux
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/rs/xhandler"
+)
+
+// HandlePatternC registers handler for a pattern in the syntax of the Go 1.22
+// http.ServeMux, made of an optional method, an optional host and a path:
+//  mux.HandlePatternC("GET /items/{id}", GetItem)
+//  mux.HandlePatternC("POST api.example.com/items", CreateItem)
+//  mux.HandlePatternC("/health", Health)
+//  mux.HandlePatternC("GET /static/", Static)
+//
+// A pattern without method is registered once for any method: the routes
+// registered for the method of a request take precedence, and the automatic
+// OPTIONS responses and the 405 responses of the other routes are kept. A path
+// ending with a '/' matches all the paths under it, the routes matching the
+// whole path and the longer subtree paths taking precedence, and redirects the
+// path without its trailing slash if RedirectTrailingSlash is set. A path
+// ending with {$} only matches itself. A pattern with a host is registered on
+// the muxer returned by Host. The path is converted like the paths given to
+// HandleC, see convertPattern, while Request.Pattern is set to pattern with
+// SetPathValues.
+func (mux *Mux) HandlePatternC(pattern string, handler xhandler.HandlerC) *Route {
+	method, host, path := splitPattern(pattern)
+	if host != "" {
+		mux = mux.Host(host)
+	}
+	return mux.handle(method, path, pattern, "", isSubtree(path), handler)
+}
+
+// HandlePattern registers a standard http.Handler for a pattern in the syntax
+// of the Go 1.22 http.ServeMux, see HandlePatternC.
+func (mux *Mux) HandlePattern(pattern string, handler http.Handler) *Route {
+	return mux.HandlePatternC(pattern, httpHandler(handler))
+}
+
+// HandlePatternC registers handler for a pattern in the syntax of the Go 1.22
+// http.ServeMux, the path being relative to the group, see Mux.HandlePatternC.
+func (g *Group) HandlePatternC(pattern string, handler xhandler.HandlerC) *Route {
+	method, host, path := splitPattern(pattern)
+	m := g.m
+	if host != "" {
+		m = m.Host(host)
+	}
+	// the pattern with the prefix of the group
+	pattern = strings.TrimSuffix(pattern, path) + g.pattern + path
+	return m.handle(method, g.subPath(path), pattern, g.version, isSubtree(path), wrap(g.mws, handler))
+}
+
+// HandlePattern registers a standard http.Handler for a pattern in the syntax
+// of the Go 1.22 http.ServeMux, see Mux.HandlePatternC.
+func (g *Group) HandlePattern(pattern string, handler http.Handler) *Route {
+	return g.HandlePatternC(pattern, httpHandler(handler))
+}
+
+// splitPattern splits a pattern of the http.ServeMux syntax into its method,
+// host and path.
+func splitPattern(pattern string) (method, host, path string) {
+	rest := pattern
+	if i := strings.IndexAny(rest, " \t"); i >= 0 {
+		method, rest = rest[:i], strings.TrimLeft(rest[i+1:], " \t")
+		if strings.ContainsAny(method, "/{}") {
+			panic("invalid method '" + method + "' in pattern '" + pattern + "'")
+		}
+	}
+	i := strings.IndexByte(rest, '/')
+	if i < 0 {
+		panic("path must begin with '/' in pattern '" + pattern + "'")
+	}
+	return method, rest[:i], rest[i:]
+}
+
+// isSubtree tells if the path of an http.ServeMux pattern matches the paths
+// under it, ending with a '/' rather than with {$}.
+func isSubtree(path string) bool {
+	return strings.HasSuffix(path, "/")
+}
+
+// convertPattern converts the {name}, {name...} and {$} wildcards of the Go
+// 1.22 http.ServeMux syntax in path into the :name and *name parameters of the
+// tree. A {name...} wildcard becomes a catch-all parameter, whose value starts
+// with '/' in Params unlike with http.ServeMux, and the {$} end anchor is
+// dropped since the routes of the tree match the whole path: /items/{$} and
+// /items/ both convert to the exact path /items/, the subtree patterns being
+// told apart with isSubtree. The wildcards must span a whole path segment,
+// braces being only allowed elsewhere in the constraints of the :name
+// parameters, paths without wildcards are returned unchanged, and the two
+// syntaxes can't be mixed in a path.
+func convertPattern(path string) string {
+	if !strings.ContainsAny(path, "{}") {
+		return path
+	}
+	segs := strings.Split(path, "/")
+	wildcards, params := false, false
+	for i, seg := range segs {
+		if seg == "" || seg[0] != '{' {
+			// the text before a :name or *name parameter, whose constraint
+			// may contain braces
+			text := seg
+			if j := strings.IndexAny(seg, ":*"); j >= 0 {
+				text, params = seg[:j], true
+			}
+			if strings.ContainsAny(text, "{}") {
+				panic("wildcards must span a whole path segment in path '" + path + "'")
+			}
+			continue
+		}
+		wildcards = true
+		if seg[len(seg)-1] != '}' || strings.ContainsAny(seg[1:len(seg)-1], "{}") {
+			panic("wildcards must span a whole path segment in path '" + path + "'")
+		}
+		last := i == len(segs)-1
+		name := seg[1 : len(seg)-1]
+		switch {
+		case name == "$":
+			if !last {
+				panic("{$} must be the last path segment in path '" + path + "'")
+			}
+			segs[i] = ""
+		case strings.HasSuffix(name, "..."):
+			if !last {
+				panic("catch-all wildcards are only allowed at the end of the path in path '" + path + "'")
+			}
+			segs[i] = "*" + checkWildcardName(name[:len(name)-3], path)
+		default:
+			segs[i] = ":" + checkWildcardName(name, path)
+		}
+	}
+	if !wildcards {
+		return path
+	}
+	if params {
+		panic("mixed wildcard syntax in path '" + path + "'")
+	}
+	return strings.Join(segs, "/")
+}
+
+// checkWildcardName returns name, panicking if it is not a valid parameter
+// name.
+func checkWildcardName(name, path string) string {
+	if !matchBytes(name, isNameChar) {
+		panic("invalid wildcard name '" + name + "' in path '" + path + "'")
+	}
+	return name
+}
@@ -0,0 +1,170 @@
+package xmux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"context"
+
+	"github.com/rs/xhandler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertPattern(t *testing.T) {
+	for path, want := range map[string]string{
+		"/":                        "/",
+		"/items/:id":               "/items/:id",
+		"/items/:id{[0-9]+}/x":     "/items/:id{[0-9]+}/x",
+		"/items/{id}":              "/items/:id",
+		"/items/{id}/tags/{tag}/":  "/items/:id/tags/:tag/",
+		"/files/{path...}":         "/files/*path",
+		"/{$}":                     "/",
+		"/items/{$}":               "/items/",
+		"/{org}/repos/{repo_name}": "/:org/repos/:repo_name",
+	} {
+		assert.Equal(t, want, convertPattern(path), path)
+	}
+
+	for path, want := range map[string]bool{
+		"/":             true,
+		"/items/":       true,
+		"/items/{id}/":  true,
+		"/{$}":          false,
+		"/items/{$}":    false,
+		"/items":        false,
+		"/files/{p...}": false,
+	} {
+		assert.Equal(t, want, isSubtree(path), path)
+	}
+
+	for path, msg := range map[string]string{
+		"/items/{id}/:tag":   "mixed wildcard syntax in path '/items/{id}/:tag'",
+		"/:org/{id}":         "mixed wildcard syntax in path '/:org/{id}'",
+		"/files/*p/{id}":     "mixed wildcard syntax in path '/files/*p/{id}'",
+		"/items/{id}.json":   "wildcards must span a whole path segment in path '/items/{id}.json'",
+		"/items/{a}{b}":      "wildcards must span a whole path segment in path '/items/{a}{b}'",
+		"/b_{bucket}/x":      "wildcards must span a whole path segment in path '/b_{bucket}/x'",
+		"/items/id}":         "wildcards must span a whole path segment in path '/items/id}'",
+		"/items/x{id}/{y}":   "wildcards must span a whole path segment in path '/items/x{id}/{y}'",
+		"/b_{bucket}:x":      "wildcards must span a whole path segment in path '/b_{bucket}:x'",
+		"/files/{path...}/x": "catch-all wildcards are only allowed at the end of the path in path '/files/{path...}/x'",
+		"/{$}/x":             "{$} must be the last path segment in path '/{$}/x'",
+		"/items/{}":          "invalid wildcard name '' in path '/items/{}'",
+		"/items/{item-id}":   "invalid wildcard name 'item-id' in path '/items/{item-id}'",
+		"/files/{...}":       "invalid wildcard name '' in path '/files/{...}'",
+	} {
+		assert.PanicsWithValue(t, msg, func() { convertPattern(path) }, path)
+	}
+}
+
+func TestMuxHandlePattern(t *testing.T) {
+	text := func(s string) xhandler.HandlerC {
+		return xhandler.HandlerFuncC(func(ctx context.Context, w http.ResponseWriter, _ *http.Request) {
+			w.Write([]byte(s))
+			for _, p := range Params(ctx) {
+				w.Write([]byte(" " + p.Name + "=" + p.Value))
+			}
+		})
+	}
+	mux := New()
+	mux.HandleOPTIONS = true
+	mux.HandleHEAD = true
+	mux.HandlePatternC("GET /items/{id}", text("item")).Name("item")
+	mux.HandlePatternC("POST\t/items/{$}", text("create"))
+	mux.HandlePatternC("/health", text("health"))
+	mux.HandlePatternC("POST /health", text("post health"))
+	mux.HandlePatternC("/static/", text("static"))
+	mux.HandlePatternC("GET /static/{dir}/", text("static dir"))
+	mux.HandlePatternC("GET /static/robots.txt", text("robots"))
+	mux.HandlePatternC("GET /", text("root"))
+	mux.HandlePatternC("GET {tenant}.example.com/files/{path...}", text("file"))
+	mux.HandlePattern("DELETE /items/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("delete " + ParamsFromRequest(r).Get("id")))
+	}))
+	mux.GET("/users/{id}", text("user"))
+	api := mux.NewGroup("/orgs/{org}")
+	api.HandlePatternC("GET /repos/{repo}", text("repo"))
+	api.GET("/members/:member", text("member"))
+
+	assert.PanicsWithValue(t, "path must begin with '/' in pattern 'GET items'", func() {
+		mux.HandlePatternC("GET items", text(""))
+	})
+	assert.PanicsWithValue(t, "invalid method 'GET/' in pattern 'GET/ /items'", func() {
+		mux.HandlePatternC("GET/ /items", text(""))
+	})
+	assert.PanicsWithValue(t, "mixed wildcard syntax in path '/items/{id}/:name'", func() {
+		mux.HandlePatternC("GET /items/{id}/:name", text(""))
+	})
+	assert.PanicsWithValue(t, "wildcards must span a whole path segment in path '/b_{bucket}/x'", func() {
+		mux.HandlePatternC("GET /b_{bucket}/x", text(""))
+	})
+
+	tests := []struct {
+		method, url, body string
+	}{
+		{"GET", "/items/42", "item id=42"},
+		{"POST", "/items/", "create"},
+		{"GET", "/health", "health"},
+		{"PATCH", "/health", "health"},
+		{"POST", "/health", "post health"},
+		{"GET", "/static/", "static"},
+		{"PUT", "/static/css/site.css", "static"},
+		{"GET", "/static/css/site.css", "static dir dir=css"},
+		{"GET", "/static/robots.txt", "robots"},
+		{"GET", "/nope", "root"},
+		{"GET", "http://acme.example.com/files/a/b", "file tenant=acme path=/a/b"},
+		{"DELETE", "/items/42", "delete 42"},
+		{"GET", "/users/7", "user id=7"},
+		{"GET", "/orgs/acme/repos/xmux", "repo org=acme repo=xmux"},
+		{"GET", "/orgs/acme/members/gopher", "member org=acme member=gopher"},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest(tt.method, tt.url, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTPC(context.Background(), w, r)
+		assert.Equal(t, 200, w.Code, tt.url)
+		assert.Equal(t, tt.body, w.Body.String(), tt.url)
+	}
+
+	for _, tt := range []struct {
+		method, url string
+		code        int
+		header      string
+	}{
+		{"OPTIONS", "/health", 204, "CONNECT, DELETE, GET, HEAD, OPTIONS, PATCH, POST, PUT, TRACE"},
+		{"PUT", "/items/42", 405, "DELETE, GET, HEAD, OPTIONS"},
+		{"POST", "/items/42/", 405, "GET, HEAD, OPTIONS"},
+		{"POST", "/items/x", 405, "DELETE, GET, HEAD, OPTIONS"},
+		{"GET", "/static", 301, "/static/"},
+		{"GET", "/static/css", 301, "/static/css/"},
+		{"HEAD", "/static/css/site.css", 200, ""},
+	} {
+		r, _ := http.NewRequest(tt.method, tt.url, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTPC(context.Background(), w, r)
+		assert.Equal(t, tt.code, w.Code, tt.method+" "+tt.url)
+		switch tt.code {
+		case 301:
+			assert.Equal(t, tt.header, w.Header().Get("Location"), tt.url)
+		case 204, 405:
+			assert.Equal(t, tt.header, w.Header().Get("Allow"), tt.method+" "+tt.url)
+		}
+	}
+
+	var patterns []string
+	mux.Walk(func(method, pattern string, _ xhandler.HandlerC) error {
+		if method == "" || pattern == "/static/:dir/*" {
+			patterns = append(patterns, method+" "+pattern)
+		}
+		return nil
+	})
+	assert.Equal(t, []string{" /health", " /static/*", "GET /static/:dir/*"}, patterns)
+	assert.True(t, mux.Remove("", "/static/*"))
+	assert.False(t, mux.Remove("", "/static/"))
+
+	u, err := mux.URL("item", "id", "42")
+	assert.NoError(t, err)
+	assert.Equal(t, "/items/42", u)
+	assert.True(t, mux.Remove("GET", "/items/{id}"))
+}
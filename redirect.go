@@ -0,0 +1,193 @@
+package xmux
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"context"
+
+	"github.com/rs/xhandler"
+)
+
+// RedirectCodes are the status codes of a kind of redirection: one for the GET
+// requests and one for the requests with another method, which should keep
+// their method and body when following the redirection. A zero code stands for
+// the default, 301 (Moved Permanently) for GET and 307 (Temporary Redirect) for
+// the other methods.
+type RedirectCodes struct {
+	GET   int
+	Other int
+}
+
+// code returns the status code of the redirection of a request with method.
+func (c RedirectCodes) code(method string) int {
+	if method == "GET" {
+		if c.GET != 0 {
+			return c.GET
+		}
+		return http.StatusMovedPermanently
+	}
+	if c.Other != 0 {
+		return c.Other
+	}
+	return http.StatusTemporaryRedirect
+}
+
+// permanentRedirects redirects permanently, keeping the method and body of the
+// non GET requests.
+var permanentRedirects = RedirectCodes{GET: http.StatusMovedPermanently, Other: http.StatusPermanentRedirect}
+
+// NewPermanent returns a new muxer configured like New, except its trailing
+// slash and fixed path redirections of the requests with another method than
+// GET use 308 (Permanent Redirect) instead of 307 (Temporary Redirect), so
+// clients and caches can remember them.
+func NewPermanent() *Mux {
+	mux := New()
+	mux.TrailingSlashRedirectCodes = permanentRedirects
+	mux.FixedPathRedirectCodes = permanentRedirects
+	return mux
+}
+
+// redirectHandler returns a handler redirecting to url with the given code.
+// Unlike http.Redirect, url is used as is for the Location header so the
+// redirection can't be cleaned into another path.
+func (mux *Mux) redirectHandler(url string, code int) xhandler.HandlerC {
+	return xhandler.HandlerFuncC(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Location", url)
+		if o := mux.opts(); o.RedirectBody != nil {
+			o.RedirectBody(ctx, w, r, url, code)
+			return
+		}
+		if r.Method == "GET" || r.Method == "HEAD" {
+			h.Set("Content-Type", "text/html; charset=utf-8")
+		}
+		w.WriteHeader(code)
+		if r.Method == "GET" {
+			fmt.Fprintf(w, "<a href=\"%s\">%s</a>.\n\n", html.EscapeString(url), http.StatusText(code))
+		}
+	})
+}
+
+// serveFixedPath serves the request whose path matches no route of root by
+// redirecting it to the path fixed by RedirectTrailingSlash or
+// RedirectFixedPath, or by serving it with the route of this path if
+// NormalizePath is set. It returns false if the path can't be fixed.
+func (mux *Mux) serveFixedPath(ctx context.Context, w http.ResponseWriter, r *http.Request, root *node, tsr bool) bool {
+	o := mux.opts()
+	path := r.URL.Path
+	var fixed, rawPath string
+	outcome, codes := OutcomeRedirectTrailingSlash, o.TrailingSlashRedirectCodes
+	if tsr && o.RedirectTrailingSlash {
+		// the escaped form of the path is kept if possible
+		raw := r.URL.RawPath
+		if len(path) > 1 && path[len(path)-1] == '/' {
+			fixed = path[:len(path)-1]
+			if strings.HasSuffix(raw, "/") {
+				rawPath = raw[:len(raw)-1]
+			}
+		} else {
+			fixed = path + "/"
+			if raw != "" {
+				rawPath = raw + "/"
+			}
+		}
+	} else if o.RedirectFixedPath {
+		fixedPath, found := root.findCaseInsensitivePath(CleanPath(path), o.RedirectTrailingSlash)
+		if !found {
+			return false
+		}
+		fixed = string(fixedPath)
+		outcome, codes = OutcomeRedirectFixedPath, o.FixedPathRedirectCodes
+	} else {
+		return false
+	}
+	// the trailing slash recommendations of the tree only hint at a route
+	if leaf, _, _ := root.find(fixed, nil); leaf == nil {
+		return false
+	}
+
+	u, ok := relativeURL(fixed, rawPath, r.URL.RawQuery)
+	if o.RejectSuspiciousPaths && (!ok || isSuspicious(r.URL)) {
+		mux.serveOutcome(ctx, w, r, OutcomeBadRequest, badRequestHandler)
+		return true
+	}
+	if !ok {
+		return false
+	}
+	if o.NormalizePath && mux.serveNormalized(ctx, w, r, root, fixed, u) {
+		return true
+	}
+	mux.serveOutcome(ctx, w, r, outcome, mux.redirectHandler(u, codes.code(r.Method)))
+	return true
+}
+
+var badRequestHandler = xhandler.HandlerFuncC(func(_ context.Context, w http.ResponseWriter, _ *http.Request) {
+	http.Error(w, "400 bad request", http.StatusBadRequest)
+})
+
+// relativeURL returns the same-origin relative URL made of path, with rawPath
+// as its escaped form if valid, and the rawQuery query. It returns false if
+// the URL would not be same-origin relative, like with a path starting with
+// "//" which browsers resolve as a host name.
+func relativeURL(path, rawPath, rawQuery string) (string, bool) {
+	if path == "" || path[0] != '/' {
+		return "", false
+	}
+	u := url.URL{Path: path, RawPath: rawPath, RawQuery: escapeQuery(rawQuery)}
+	s := u.String()
+	return s, isRelativePath(s)
+}
+
+// escapeQuery escapes the bytes of the raw query q which would end it or be
+// invalid in a URL, like '#', so it is kept as is by the client.
+func escapeQuery(q string) string {
+	var buf []byte
+	for i := 0; i < len(q); i++ {
+		c := q[i]
+		if c != '#' && c > ' ' && c < 0x7f {
+			if buf != nil {
+				buf = append(buf, c)
+			}
+			continue
+		}
+		if buf == nil {
+			buf = append(make([]byte, 0, len(q)+8), q[:i]...)
+		}
+		buf = append(buf, '%', "0123456789ABCDEF"[c>>4], "0123456789ABCDEF"[c&15])
+	}
+	if buf == nil {
+		return q
+	}
+	return string(buf)
+}
+
+// isRelativePath tells if path starts with a single slash, not followed by a
+// backslash which browsers handle like a slash.
+func isRelativePath(path string) bool {
+	return path != "" && path[0] == '/' && (len(path) == 1 || (path[1] != '/' && path[1] != '\\'))
+}
+
+// isSuspicious tells if the path of u has backslashes, encoded slashes or
+// backslashes, or control characters, which clients, proxies and handlers may
+// interpret differently.
+func isSuspicious(u *url.URL) bool {
+	for i := 0; i < len(u.Path); i++ {
+		if c := u.Path[i]; c == '\\' || c < 0x20 || c == 0x7f {
+			return true
+		}
+	}
+	raw := u.RawPath
+	for i := 0; i+2 < len(raw); i++ {
+		if raw[i] != '%' {
+			continue
+		}
+		if c := raw[i+2] | 0x20; (raw[i+1] == '2' && c == 'f') || (raw[i+1] == '5' && c == 'c') {
+			return true
+		}
+	}
+	return false
+}
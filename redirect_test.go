@@ -0,0 +1,198 @@
+package xmux
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"context"
+
+	"github.com/rs/xhandler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMuxRedirectCodes(t *testing.T) {
+	handler := xhandler.HandlerFuncC(func(_ context.Context, _ http.ResponseWriter, _ *http.Request) {})
+	newMux := func(mux *Mux) *Mux {
+		mux.GET("/path", handler)
+		mux.POST("/path", handler)
+		return mux
+	}
+	custom := newMux(New())
+	custom.TrailingSlashRedirectCodes = RedirectCodes{GET: http.StatusFound, Other: http.StatusPermanentRedirect}
+	custom.FixedPathRedirectCodes = RedirectCodes{Other: http.StatusPermanentRedirect}
+
+	tests := []struct {
+		mux          *Mux
+		method, path string
+		code         int
+	}{
+		{newMux(New()), "GET", "/path/", http.StatusMovedPermanently},
+		{newMux(New()), "POST", "/path/", http.StatusTemporaryRedirect},
+		{newMux(New()), "POST", "/PATH", http.StatusTemporaryRedirect},
+		{newMux(NewPermanent()), "GET", "/path/", http.StatusMovedPermanently},
+		{newMux(NewPermanent()), "POST", "/path/", http.StatusPermanentRedirect},
+		{newMux(NewPermanent()), "GET", "/PATH", http.StatusMovedPermanently},
+		{newMux(NewPermanent()), "POST", "/PATH", http.StatusPermanentRedirect},
+		{custom, "GET", "/path/", http.StatusFound},
+		{custom, "POST", "/path/", http.StatusPermanentRedirect},
+		{custom, "GET", "/PATH", http.StatusMovedPermanently},
+		{custom, "POST", "/PATH", http.StatusPermanentRedirect},
+	}
+	for i, tt := range tests {
+		r, _ := http.NewRequest(tt.method, tt.path, nil)
+		w := httptest.NewRecorder()
+		tt.mux.ServeHTTPC(context.Background(), w, r)
+		assert.Equal(t, tt.code, w.Code, "test %d", i)
+		assert.Equal(t, "/path", w.Header().Get("Location"), "test %d", i)
+	}
+}
+
+func TestMuxRedirectBody(t *testing.T) {
+	mux := New()
+	mux.GET("/path", xhandler.HandlerFuncC(func(_ context.Context, _ http.ResponseWriter, _ *http.Request) {}))
+	mux.RedirectBody = func(_ context.Context, w http.ResponseWriter, _ *http.Request, url string, code int) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		fmt.Fprintf(w, `{"location":%q}`, url)
+	}
+
+	r, _ := http.NewRequest("GET", "/path/?q=1", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTPC(context.Background(), w, r)
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/path?q=1", w.Header().Get("Location"))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, `{"location":"/path?q=1"}`, w.Body.String())
+}
+
+// newRedirectMux returns a muxer with routes exercising the trailing slash and
+// fixed path redirections.
+func newRedirectMux() *Mux {
+	handler := xhandler.HandlerFuncC(func(_ context.Context, _ http.ResponseWriter, _ *http.Request) {})
+	mux := New()
+	mux.GET("/", handler)
+	mux.GET("/a", handler)
+	mux.GET("/users/:name", handler)
+	mux.GET("/files/*path", handler)
+	mux.GET("/:x/y/", handler)
+	mux.GET("/Doc/", handler)
+	return mux
+}
+
+// serveRaw serves a request for the raw request target with mux.
+func serveRaw(mux *Mux, target string) (*http.Request, *httptest.ResponseRecorder, bool) {
+	r, err := http.ReadRequest(bufio.NewReader(strings.NewReader("GET " + target + " HTTP/1.1\r\nHost: example.com\r\n\r\n")))
+	if err != nil {
+		return nil, nil, false
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTPC(context.Background(), w, r)
+	return r, w, true
+}
+
+func TestMuxRedirectHardening(t *testing.T) {
+	tests := []struct {
+		target   string
+		code     int
+		location string
+		strict   int
+	}{
+		{"/a/", 301, "/a", 301},
+		{"/a/?x=1&y=%2F", 301, "/a?x=1&y=%2F", 301},
+		{"http://evil.com/a/?x=1", 301, "/a?x=1", 301},
+		{"//evil.com/..", 301, "/", 301},
+		{"//evil.com/../a", 301, "/a", 301},
+		{"/%2F%2Fevil.com/..", 301, "/", 400},
+		{"/%2Fa", 301, "/a", 400},
+		{"/users/a%3Bb/", 301, "/users/a%3Bb", 301},
+		{"/users/a%2Fb/", 404, "", 404},
+		{"/doc", 301, "/Doc/", 301},
+		// the fixed paths starting with "//" are not used
+		{"//y", 404, "", 400},
+		{"/%2Fy", 301, "/%2Fy/", 400},
+		// backslashes are escaped
+		{"/%5Cevil.com/y", 301, "/%5Cevil.com/y/", 400},
+		{"/\\evil.com/y", 301, "/%5Cevil.com/y/", 400},
+		{"/a%0D%0ALocation:%20x/y", 301, "/a%0D%0ALocation:%20x/y/", 400},
+	}
+	mux := newRedirectMux()
+	strict := newRedirectMux()
+	strict.RejectSuspiciousPaths = true
+	for _, tt := range tests {
+		_, w, ok := serveRaw(mux, tt.target)
+		if !assert.True(t, ok, tt.target) {
+			continue
+		}
+		assert.Equal(t, tt.code, w.Code, tt.target)
+		assert.Equal(t, tt.location, w.Header().Get("Location"), tt.target)
+
+		_, w, _ = serveRaw(strict, tt.target)
+		assert.Equal(t, tt.strict, w.Code, tt.target)
+	}
+}
+
+func FuzzMuxRedirect(f *testing.F) {
+	for _, target := range []string{
+		"/a/", "/A", "/a/?q=1", "//evil.com/..", "//evil.com/../a", "///evil.com/",
+		"/%2F%2Fevil.com/..", "/%2Fy", "//y", "/\\evil.com/y", "/%5C%5Cevil.com/y",
+		"/users/a%3Bb/", "/USERS/x%2Fy", "/files", "/FILES/a/../b", "/doc?x=%zz",
+		"/a%0D%0A/y", "/../a", "/./Doc", "http://evil.com/a/", "/:x/y", "/A?#", "/A?\xb9",
+	} {
+		f.Add(target)
+	}
+	mux := newRedirectMux()
+	strict := newRedirectMux()
+	strict.RejectSuspiciousPaths = true
+	f.Fuzz(func(t *testing.T, target string) {
+		for _, m := range []*Mux{mux, strict} {
+			r, w, ok := serveRaw(m, target)
+			if !ok {
+				return
+			}
+			if w.Code < 300 || w.Code >= 400 {
+				continue
+			}
+			if m.RejectSuspiciousPaths && isSuspicious(r.URL) {
+				t.Fatalf("%q: suspicious path redirected", target)
+			}
+			loc := w.Header().Get("Location")
+			if !isRelativePath(loc) {
+				t.Fatalf("%q: redirected to %q, not a same-origin relative URL", target, loc)
+			}
+			u, err := url.Parse(loc)
+			if err != nil || u.Scheme != "" || u.Host != "" {
+				t.Fatalf("%q: redirected to %q, not a same-origin relative URL", target, loc)
+			}
+			if u.Fragment != "" || unescapeQuery(u.RawQuery) != unescapeQuery(r.URL.RawQuery) {
+				t.Fatalf("%q: redirected to %q, query %q not kept", target, loc, r.URL.RawQuery)
+			}
+			// the redirection leads to a route
+			if _, w, ok := serveRaw(m, loc); !ok || w.Code != http.StatusOK {
+				t.Fatalf("%q: redirected to %q which is not served", target, loc)
+			}
+		}
+	})
+}
+
+// unescapeQuery unescapes the bytes of the query a redirection escapes: '#',
+// spaces, control and non-ASCII bytes.
+func unescapeQuery(q string) string {
+	var buf []byte
+	for i := 0; i < len(q); i++ {
+		if q[i] == '%' && i+2 < len(q) {
+			if c, err := strconv.ParseUint(q[i+1:i+3], 16, 8); err == nil && (c == '#' || c <= ' ' || c >= 0x7f) {
+				buf = append(buf, byte(c))
+				i += 2
+				continue
+			}
+		}
+		buf = append(buf, q[i])
+	}
+	return string(buf)
+}
@@ -0,0 +1,256 @@
+package xmux
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/xhandler"
+)
+
+// table holds the routes of a muxer: one tree per method, the routes
+// registered for any method having the empty method, the subtree patterns of
+// http.ServeMux by method, the named routes, the muxers of the hosts, the
+// versioned routes by method and path and the fallbacks by decreasing prefix
+// length.
+//
+// A table is never modified once published, the route registrations apply to
+// a copy of the current table which then replaces it. The copy shares the
+// trees, maps and slices of the table, which are copied on their first
+// modification by an update. The named routes are the exception: they are
+// shared by the successive tables of a muxer, see routeNames.
+type table struct {
+	trees     map[string]*node
+	subtrees  map[string]*node
+	names     *routeNames
+	hosts     []*hostRoute
+	versions  map[string]*versionSwitch
+	fallbacks []*fallback
+
+	// middleware chain of the responses which are not served by a route, nil
+	// without middleware
+	outcomeChain xhandler.HandlerC
+
+	// roots copied by the current update
+	copied map[*node]bool
+	// collections copied by the current update
+	copiedVersions, copiedHosts, copiedFallbacks bool
+}
+
+// routeNames holds the named routes of a muxer. Naming a route is frequent
+// and adds no route, so the names are updated in place rather than copied with
+// the table, which would make naming n routes quadratic. The names are added
+// and removed by the updates of the muxer, under its lock.
+type routeNames struct {
+	mu     sync.RWMutex
+	routes map[string]*Route
+}
+
+// get returns the route named name, nil if none. It is safe to call on a nil
+// n.
+func (n *routeNames) get(name string) *Route {
+	if n == nil {
+		return nil
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.routes[name]
+}
+
+// add names r, panicking if the name is taken.
+func (n *routeNames) add(name string, r *Route) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, found := n.routes[name]; found {
+		panic("a route is already named '" + name + "' for path '" + r.path + "'")
+	}
+	n.routes[name] = r
+}
+
+// remove removes the names of the routes for which match returns true.
+func (n *routeNames) remove(match func(r *Route) bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for name, r := range n.routes {
+		if match(r) {
+			delete(n.routes, name)
+		}
+	}
+}
+
+var emptyTable = &table{}
+
+// muxRef references the muxer serving the routes registered on a muxer. The
+// routes, versioned routes and host muxers read it to find their muxer, which
+// changes when their table is moved to another muxer with Swap.
+type muxRef struct {
+	mux atomic.Pointer[Mux]
+}
+
+// load returns the current route table of the muxer.
+func (mux *Mux) load() *table {
+	if t := mux.current.Load(); t != nil {
+		return t
+	}
+	return emptyTable
+}
+
+// update calls fn with a copy of the current route table, creating it if
+// needed, and publishes the copy. The requests being served keep the table
+// they loaded, and updates of the same muxer are serialized. If fn panics, the
+// current table is left unchanged.
+func (mux *Mux) update(fn func(t *table)) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	cur := mux.current.Load()
+	t := cur.clone()
+	if mws := mux.middleware(); cur == nil && len(mws) > 0 {
+		t.outcomeChain = wrap(mws, outcomeDispatch)
+	}
+	fn(t)
+	t.copied = nil
+	t.copiedVersions, t.copiedHosts, t.copiedFallbacks = false, false, false
+	mux.current.Store(t)
+}
+
+// ref returns the reference to mux given to the routes registered on it. It
+// must be called with mux.mu held.
+func (mux *Mux) ref() *muxRef {
+	if mux.self == nil {
+		mux.self = new(muxRef)
+		mux.self.mux.Store(mux)
+	}
+	return mux.self
+}
+
+// clone returns a copy of t sharing its trees and collections, which are
+// copied on demand by tree, subtree, writeVersions, writeHosts and
+// writeFallbacks. A nil t is cloned into an empty table.
+func (t *table) clone() *table {
+	if t == nil {
+		return &table{
+			trees:    make(map[string]*node),
+			subtrees: make(map[string]*node),
+			names:    &routeNames{routes: make(map[string]*Route)},
+			versions: make(map[string]*versionSwitch),
+			// nothing to share yet
+			copiedVersions:  true,
+			copiedHosts:     true,
+			copiedFallbacks: true,
+		}
+	}
+	c := *t
+	// the maps of the roots are small, one entry per method
+	c.trees = make(map[string]*node, len(t.trees))
+	for method, root := range t.trees {
+		c.trees[method] = root
+	}
+	c.subtrees = make(map[string]*node, len(t.subtrees))
+	for method, root := range t.subtrees {
+		c.subtrees[method] = root
+	}
+	return &c
+}
+
+// writeVersions returns the versioned routes of t for them to be modified,
+// copying them first if shared with the previous table.
+func (t *table) writeVersions() map[string]*versionSwitch {
+	if !t.copiedVersions {
+		versions := make(map[string]*versionSwitch, len(t.versions))
+		for key, vs := range t.versions {
+			versions[key] = vs
+		}
+		t.versions, t.copiedVersions = versions, true
+	}
+	return t.versions
+}
+
+// writeHosts returns the hosts of t for them to be modified, like
+// writeVersions.
+func (t *table) writeHosts() []*hostRoute {
+	if !t.copiedHosts {
+		t.hosts, t.copiedHosts = append([]*hostRoute(nil), t.hosts...), true
+	}
+	return t.hosts
+}
+
+// writeFallbacks returns the fallbacks of t for them to be modified, like
+// writeVersions.
+func (t *table) writeFallbacks() []*fallback {
+	if !t.copiedFallbacks {
+		t.fallbacks, t.copiedFallbacks = append([]*fallback(nil), t.fallbacks...), true
+	}
+	return t.fallbacks
+}
+
+// hasRoutes tells if any route is registered in t.
+func (t *table) hasRoutes() bool {
+	return len(t.trees) > 0 || len(t.subtrees) > 0
+}
+
+// tree returns the root of the tree of method for the routes to be modified,
+// creating it if needed. The nodes of the previous table are copied before
+// being modified.
+func (t *table) tree(method string) *node {
+	return t.copyRoot(t.trees, method)
+}
+
+// subtree returns the root of the subtree patterns of method for the routes
+// to be modified, like tree.
+func (t *table) subtree(method string) *node {
+	return t.copyRoot(t.subtrees, method)
+}
+
+func (t *table) copyRoot(trees map[string]*node, method string) *node {
+	if t.copied == nil {
+		t.copied = make(map[*node]bool)
+	}
+	root := trees[method]
+	if root == nil || !t.copied[root] {
+		if root == nil {
+			root = new(node)
+		} else {
+			root = root.copy()
+		}
+		trees[method] = root
+		t.copied[root] = true
+	}
+	return root
+}
+
+// swapMu serializes the calls to Swap, which lock two muxers.
+var swapMu sync.Mutex
+
+// Swap atomically replaces the routes of mux with the routes registered on
+// src. It is meant to reload the routes of a muxer while it is serving
+// requests: the new routes are registered on a muxer built off to the side,
+// then published with Swap. Requests being served when Swap is called finish
+// with the previous routes, the following ones use the new routes.
+//
+// Only the routes, their names, the host muxers and the fallbacks are taken
+// from src, the options and the NotFound, MethodNotAllowed and PanicHandler
+// handlers of mux are kept. Routes registered on src, as well as the responses
+// which are not served by a route, are wrapped with the middleware of src, not
+// of mux. The routes moved belong to mux from then on: naming a Route
+// returned by src adds the name to mux, and the versioned routes and the host
+// muxers use the options of mux.
+//
+// The routes are moved: src is left without routes and routes registered on it
+// after the call do not affect mux.
+func (mux *Mux) Swap(src *Mux) {
+	if src == mux {
+		return
+	}
+	// a.Swap(b) and b.Swap(a) would otherwise lock the muxers in opposite
+	// orders
+	swapMu.Lock()
+	defer swapMu.Unlock()
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	if src.self != nil {
+		src.self.mux.Store(mux)
+		src.self = nil
+	}
+	mux.current.Store(src.current.Swap(nil))
+}
@@ -7,8 +7,10 @@
 package xmux
 
 import (
+	"sort"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/rs/xhandler"
 )
@@ -27,6 +29,10 @@ func countParams(path string) uint8 {
 			continue
 		}
 		n++
+		// skip the constraint, it may contain ':' or '*'
+		if nameEnd, end := wildcardEnd(path, i); end > nameEnd {
+			i = end - 1
+		}
 	}
 	if n >= 255 {
 		return 255
@@ -51,7 +57,39 @@ type node struct {
 	indices   string
 	children  []*node
 	handler   xhandler.HandlerC
+	pattern   string
 	priority  uint32
+
+	// route as registered, set as Request.Pattern, which may differ from the
+	// pattern of the leaf for a path with optional parameters or in the
+	// http.ServeMux syntax
+	route string
+	// path registered with addPattern, which pattern is a variant of if it
+	// has optional parameters
+	registered string
+
+	// values of the optional parameters missing from the pattern of the leaf
+	defaults ParamHolder
+
+	// constraint of a parameter node, if any
+	constraint *constraint
+}
+
+// copy returns a copy of the node, sharing its children, which can be
+// modified without affecting the tree n belongs to.
+func (n *node) copy() *node {
+	c := *n
+	c.children = append([]*node(nil), n.children...)
+	return &c
+}
+
+// copyChild replaces the child at pos by a copy and returns it. The routes
+// are added to and removed from a tree by copying the nodes along their path,
+// the other nodes being shared with the previous version of the tree.
+func (n *node) copyChild(pos int) *node {
+	child := n.children[pos].copy()
+	n.children[pos] = child
+	return child
 }
 
 // increments priority of the given child and reorders if necessary
@@ -80,9 +118,28 @@ func (n *node) incrementChildPrio(pos int) int {
 	return newPos
 }
 
-// addRoute adds a node with the given handle to the path.
+// addRoute adds a node with the given handle to the path. A path with optional
+// parameters is expanded into the variants with and without them. The nodes
+// along the path are copied before being modified, n must be a copy already.
 // Not concurrency-safe!
 func (n *node) addRoute(path string, handler xhandler.HandlerC) {
+	n.addPattern(path, path, handler)
+}
+
+// addPattern is like addRoute, route being the route as registered which path
+// was converted from.
+func (n *node) addPattern(path, route string, handler xhandler.HandlerC) {
+	for _, v := range expandOptional(path) {
+		leaf := n.insertRoute(v.path, handler)
+		leaf.defaults = v.defaults
+		leaf.route = route
+		leaf.registered = path
+	}
+}
+
+// insertRoute adds a node with the given handle to the path and returns the
+// leaf holding it.
+func (n *node) insertRoute(path string, handler xhandler.HandlerC) *node {
 	fullPath := path
 	n.priority++
 	numParams := countParams(path)
@@ -108,12 +165,16 @@ func (n *node) addRoute(path string, handler xhandler.HandlerC) {
 			// Split edge
 			if i < len(n.path) {
 				child := node{
-					path:      n.path[i:],
-					wildChild: n.wildChild,
-					indices:   n.indices,
-					children:  n.children,
-					handler:   n.handler,
-					priority:  n.priority - 1,
+					path:       n.path[i:],
+					wildChild:  n.wildChild,
+					indices:    n.indices,
+					children:   n.children,
+					handler:    n.handler,
+					pattern:    n.pattern,
+					route:      n.route,
+					registered: n.registered,
+					defaults:   n.defaults,
+					priority:   n.priority - 1,
 				}
 
 				// Update maxParams (max of all children)
@@ -128,41 +189,58 @@ func (n *node) addRoute(path string, handler xhandler.HandlerC) {
 				n.indices = string([]byte{n.path[i]})
 				n.path = path[:i]
 				n.handler = nil
+				n.pattern = ""
+				n.route = ""
+				n.registered = ""
+				n.defaults = nil
 				n.wildChild = false
 			}
 
 			// Make new node a child of this node
 			if i < len(path) {
 				path = path[i:]
+				c := path[0]
 
-				if n.wildChild {
-					n = n.children[0]
-					n.priority++
-
-					// Update maxParams of the child node
-					if numParams > n.maxParams {
-						n.maxParams = numParams
-					}
-					numParams--
-
-					// Check if the wildcard matches
-					if len(path) >= len(n.path) && n.path == path[:len(n.path)] {
-						// check for longer wildcard, e.g. :name and :names
-						if len(n.path) >= len(path) || path[len(n.path)] == '/' {
+				// The wildcard children always follow the static children.
+				// Static children may coexist with parameters.
+				if n.wildChild && (c == ':' || c == '*' || n.nType == catchAll) {
+					for j := len(n.indices); j < len(n.children); j++ {
+						// Check if the wildcard matches, the whole wildcard
+						// must be compared to tell :name and :names apart
+						if isWildcard(path, n.children[j].path) {
+							n = n.copyChild(j)
+							n.priority++
+
+							// Update maxParams of the child node
+							if numParams > n.maxParams {
+								n.maxParams = numParams
+							}
+							numParams--
 							continue walk
 						}
 					}
 
+					// Constrained parameters may be added next to other
+					// parameters
+					if c == ':' && n.canAddParam(path) {
+						return n.insertChild(numParams, path, fullPath, handler)
+					}
+
 					panic("path segment '" + path +
-						"' conflicts with existing wildcard '" + n.path +
+						"' conflicts with existing wildcard '" + n.children[len(n.children)-1].path +
 						"' in path '" + fullPath + "'")
 				}
 
-				c := path[0]
+				// a parameter is followed by static text, which may not
+				// start with another wildcard
+				if n.nType == parameter && (c == ':' || c == '*') {
+					panic("wildcards must be separated by static text, has: '" +
+						n.path + path + "' in path '" + fullPath + "'")
+				}
 
-				// slash after param
-				if n.nType == parameter && c == '/' && len(n.children) == 1 {
-					n = n.children[0]
+				// slash or static text after param
+				if n.nType == parameter && len(n.children) == 1 {
+					n = n.copyChild(0)
 					n.priority++
 					continue walk
 				}
@@ -170,6 +248,7 @@ func (n *node) addRoute(path string, handler xhandler.HandlerC) {
 				// Check if a child with the next path byte exists
 				for i := 0; i < len(n.indices); i++ {
 					if c == n.indices[i] {
+						n.copyChild(i)
 						i = n.incrementChildPrio(i)
 						n = n.children[i]
 						continue walk
@@ -178,33 +257,39 @@ func (n *node) addRoute(path string, handler xhandler.HandlerC) {
 
 				// Otherwise insert it
 				if c != ':' && c != '*' {
+					// insert before the wildcard children, if any
+					pos := len(n.indices)
 					// []byte for proper unicode char conversion, see #65
 					n.indices += string([]byte{c})
 					child := &node{
 						maxParams: numParams,
 					}
-					n.children = append(n.children, child)
-					n.incrementChildPrio(len(n.indices) - 1)
+					n.children = append(n.children, nil)
+					copy(n.children[pos+1:], n.children[pos:])
+					n.children[pos] = child
+					n.incrementChildPrio(pos)
 					n = child
 				}
-				n.insertChild(numParams, path, fullPath, handler)
-				return
+				return n.insertChild(numParams, path, fullPath, handler)
 
 			} else if i == len(path) { // Make node a (in-path) leaf
 				if n.handler != nil {
 					panic("a handler is already registered for path '" + fullPath + "'")
 				}
 				n.handler = handler
+				n.pattern = fullPath
 			}
-			return
+			return n
 		}
 	} else { // Empty tree
-		n.insertChild(numParams, path, fullPath, handler)
+		n.maxParams = numParams
+		leaf := n.insertChild(numParams, path, fullPath, handler)
 		n.nType = root
+		return leaf
 	}
 }
 
-func (n *node) insertChild(numParams uint8, path, fullPath string, handler xhandler.HandlerC) {
+func (n *node) insertChild(numParams uint8, path, fullPath string, handler xhandler.HandlerC) *node {
 	var offset int // already handled bytes of the path
 
 	// find prefix until first wildcard (beginning with ':'' or '*'')
@@ -214,28 +299,41 @@ func (n *node) insertChild(numParams uint8, path, fullPath string, handler xhand
 			continue
 		}
 
-		// find wildcard end (either '/' or path end)
-		end := i + 1
-		for end < max && path[end] != '/' {
-			switch path[end] {
-			// the wildcard name must not contain ':' and '*'
-			case ':', '*':
-				panic("only one wildcard per path segment is allowed, has: '" +
-					path[i:] + "' in path '" + fullPath + "'")
-			default:
-				end++
+		// find wildcard end and the end of its name, followed by the
+		// optional constraint
+		nameEnd, end := wildcardEnd(path, i)
+		if end < 0 {
+			panic("unterminated parameter constraint in path '" + fullPath + "'")
+		}
+		// names used to span the segment, reject the ones which would now
+		// end on a non-ASCII char instead of silently splitting them
+		if c == ':' && nameEnd < max && path[nameEnd] >= utf8.RuneSelf {
+			segEnd := strings.IndexByte(path[i:], '/')
+			if segEnd < 0 {
+				segEnd = len(path) - i
 			}
+			panic("parameter names must be made of ASCII letters, digits and '_', has: '" +
+				path[i:i+segEnd] + "' in path '" + fullPath + "'")
+		}
+		// a parameter can be followed by static text in the same path
+		// segment, but not by another wildcard as their values could not be
+		// told apart
+		if (i == 0 && n.nType == parameter) ||
+			(end < max && (path[end] == ':' || path[end] == '*')) {
+			panic("wildcards must be separated by static text, has: '" +
+				path[i:] + "' in path '" + fullPath + "'")
 		}
 
 		// check if this Node existing children which would be
-		// unreachable if we insert the wildcard here
-		if len(n.children) > 0 {
+		// unreachable if we insert the wildcard here. Static children take
+		// priority over parameters but would be shadowed by a catch-all.
+		if len(n.children) > 0 && (c == '*' || (n.wildChild && !n.canAddParam(path[i:]))) {
 			panic("wildcard route '" + path[i:end] +
 				"' conflicts with existing children in path '" + fullPath + "'")
 		}
 
 		// check if the wildcard has a name
-		if end-i < 2 {
+		if nameEnd-i < 2 {
 			panic("wildcards must be named with a non-empty name in path '" + fullPath + "'")
 		}
 
@@ -250,7 +348,15 @@ func (n *node) insertChild(numParams uint8, path, fullPath string, handler xhand
 				nType:     parameter,
 				maxParams: numParams,
 			}
-			n.children = []*node{child}
+			if nameEnd < end {
+				child.constraint = newConstraint(path[i+1:nameEnd], path[nameEnd:end], fullPath)
+			}
+			if last := len(n.children) - 1; n.wildChild && n.children[last].constraint == nil {
+				// constrained parameters are tried before the unconstrained one
+				n.children = append(n.children[:last], child, n.children[last])
+			} else {
+				n.children = append(n.children, child)
+			}
 			n.wildChild = true
 			n = child
 			n.priority++
@@ -270,6 +376,9 @@ func (n *node) insertChild(numParams uint8, path, fullPath string, handler xhand
 				n = child
 			}
 
+			// skip the constraint, it may contain ':' or '*'
+			i = end - 1
+
 		} else { // catchAll
 			if end != max || numParams > 1 {
 				panic("catch-all routes are only allowed at the end of the path in path '" + fullPath + "'")
@@ -304,17 +413,256 @@ func (n *node) insertChild(numParams uint8, path, fullPath string, handler xhand
 				nType:     catchAll,
 				maxParams: 1,
 				handler:   handler,
+				pattern:   fullPath,
 				priority:  1,
 			}
 			n.children = []*node{child}
 
-			return
+			return child
 		}
 	}
 
 	// insert remaining path part and handle to the leaf
 	n.path = path[offset:]
 	n.handler = handler
+	n.pattern = fullPath
+	return n
+}
+
+// removeRoute removes the handler registered with the pattern path, or all its
+// variants if it has optional parameters. It returns false if no handler is
+// registered with this pattern, like for a variant of a pattern with optional
+// parameters. Like with addRoute, n must be a copy.
+// Not concurrency-safe!
+func (n *node) removeRoute(path string) bool {
+	removed := false
+	for _, v := range expandOptional(path) {
+		if n.removeVariant(v.path, path) {
+			removed = true
+		}
+	}
+	return removed
+}
+
+// removeVariant removes the handler of the variant path of the registered
+// pattern and prunes the nodes it leaves behind. Edges split by the removed
+// route are merged back and the priority, maxParams and indices of the
+// ancestors are recomputed.
+func (n *node) removeVariant(path, registered string) bool {
+	fullPath := path
+
+	// Find the node holding the handler, keeping track of its ancestors
+	var stack []*node
+	for {
+		if len(path) < len(n.path) || path[:len(n.path)] != n.path {
+			return false
+		}
+		path = path[len(n.path):]
+		stack = append(stack, n)
+		if path == "" {
+			break
+		}
+		if n.nType == parameter {
+			if len(n.children) == 0 {
+				return false
+			}
+			n = n.copyChild(0)
+			continue
+		}
+		if n.wildChild && (path[0] == ':' || path[0] == '*' || n.nType == catchAll) {
+			j := len(n.children) - 1
+			for k := len(n.indices); k < len(n.children); k++ {
+				if isWildcard(path, n.children[k].path) {
+					j = k
+					break
+				}
+			}
+			n = n.copyChild(j)
+			continue
+		}
+		i := strings.IndexByte(n.indices, path[0])
+		if i < 0 {
+			return false
+		}
+		n = n.copyChild(i)
+	}
+	if n.handler == nil || n.pattern != fullPath || n.registered != registered {
+		return false
+	}
+	n.handler = nil
+	n.pattern = ""
+	n.route = ""
+	n.registered = ""
+	n.defaults = nil
+
+	// Walk back up the tree
+	for i := len(stack) - 1; i >= 0; i-- {
+		n = stack[i]
+		n.priority--
+		if i+1 < len(stack) {
+			if child := stack[i+1]; child.handler == nil && len(child.children) == 0 {
+				n.removeChild(child)
+			}
+		}
+		n.mergeChild()
+		n.sortChildren()
+		n.updateMaxParams()
+	}
+	return true
+}
+
+// removeChild removes the given child node.
+func (n *node) removeChild(child *node) {
+	for i := range n.children {
+		if n.children[i] != child {
+			continue
+		}
+		n.children = append(n.children[:i:i], n.children[i+1:]...)
+		if i < len(n.indices) {
+			n.indices = n.indices[:i] + n.indices[i+1:]
+		} else if n.wildChild {
+			n.wildChild = len(n.children) > len(n.indices)
+		}
+		return
+	}
+}
+
+// mergeChild merges a static node with no handler with its only child if it
+// is a static node too, undoing the edge split made when a sibling was added.
+func (n *node) mergeChild() {
+	if n.handler != nil || n.wildChild || len(n.children) != 1 ||
+		(n.nType != static && n.nType != root) {
+		return
+	}
+	child := n.children[0]
+	if child.nType != static {
+		return
+	}
+	n.path += child.path
+	n.wildChild = child.wildChild
+	n.indices = child.indices
+	// the child may be shared with the previous version of the tree
+	n.children = append([]*node(nil), child.children...)
+	n.handler = child.handler
+	n.pattern = child.pattern
+	n.route = child.route
+	n.registered = child.registered
+	n.defaults = child.defaults
+}
+
+// sortChildren reorders the static children by priority after one of them
+// got its priority decreased.
+func (n *node) sortChildren() {
+	indices := []byte(n.indices)
+	for i := 1; i < len(indices); i++ {
+		for j := i; j > 0 && n.children[j-1].priority < n.children[j].priority; j-- {
+			n.children[j-1], n.children[j] = n.children[j], n.children[j-1]
+			indices[j-1], indices[j] = indices[j], indices[j-1]
+		}
+	}
+	n.indices = string(indices)
+}
+
+// updateMaxParams recomputes maxParams from the children of the node.
+func (n *node) updateMaxParams() {
+	var maxParams uint8
+	for _, child := range n.children {
+		if child.maxParams > maxParams {
+			maxParams = child.maxParams
+		}
+	}
+	if n.nType > root && !n.wildChild {
+		maxParams++
+	}
+	n.maxParams = maxParams
+}
+
+// paramName returns the name of the parameter node, without its constraint.
+func (n *node) paramName() string {
+	if n.constraint != nil {
+		return n.constraint.name
+	}
+	return n.path[1:]
+}
+
+// paramEnd returns the end of the value of the parameter node n at the
+// beginning of path. The value stops at the next '/' or at the first char
+// which can follow the parameter in the same path segment, like the '.' of
+// :name.:ext.
+func (n *node) paramEnd(path string) int {
+	var stops string
+	if len(n.children) > 0 {
+		if child := n.children[0]; child.path != "" {
+			stops = child.path[:1]
+		} else {
+			stops = child.indices
+		}
+	}
+	end := 0
+	if stops == "" || stops == "/" {
+		for end < len(path) && path[end] != '/' {
+			end++
+		}
+		return end
+	}
+	for end < len(path) && path[end] != '/' && strings.IndexByte(stops, path[end]) < 0 {
+		end++
+	}
+	return end
+}
+
+// next returns the child of the parameter node n whose path begins with c,
+// or nil.
+func (n *node) next(c byte) *node {
+	child := n.children[0]
+	if child.path == "" {
+		if i := strings.IndexByte(child.indices, c); i >= 0 {
+			return child.children[i]
+		}
+		return nil
+	}
+	if child.path[0] != c {
+		return nil
+	}
+	return child
+}
+
+// isWildcard tells if path begins with the whole wildcard w.
+func isWildcard(path, w string) bool {
+	if !strings.HasPrefix(path, w) {
+		return false
+	}
+	i := 0
+	if w[0] == '/' {
+		// the path of a catch-all leaf includes the '/' before the wildcard
+		i = 1
+	}
+	_, end := wildcardEnd(path, i)
+	return end == len(w)
+}
+
+// withDefaults completes the parameters matched by the leaf n with the default
+// values of its missing optional parameters.
+func (n *node) withDefaults(params ParamHolder) ParamHolder {
+	if n.defaults == nil {
+		return params
+	}
+	return append(params, n.defaults...)
+}
+
+// canAddParam tells if the parameter starting path can be added next to the
+// existing wildcard children of the node. Any number of constrained parameters
+// can be registered for the same path segment, but only one unconstrained
+// parameter and no catch-all.
+func (n *node) canAddParam(path string) bool {
+	last := n.children[len(n.children)-1]
+	if last.nType != parameter {
+		return false
+	}
+	if nameEnd, end := wildcardEnd(path, 0); end > nameEnd {
+		return true
+	}
+	return last.constraint != nil
 }
 
 // Returns the handler registered with the given path (key). The values of
@@ -323,102 +671,147 @@ func (n *node) insertChild(numParams uint8, path, fullPath string, handler xhand
 // made if a handler exists with an extra (without the) trailing slash for the
 // given path.
 func (n *node) getValue(path string) (handler xhandler.HandlerC, params ParamHolder, tsr bool) {
+	leaf, params, tsr := n.find(path, nil)
+	if leaf != nil {
+		handler = leaf.handler
+	}
+	return handler, params, tsr
+}
+
+// lookup looks up path like find. If no route matches and fold is true, the
+// route matching path with a different case, if any, is returned with the
+// parameter values in the case of path.
+func (n *node) lookup(path string, fold bool) (leaf *node, params ParamHolder, tsr bool) {
+	leaf, params, tsr = n.find(path, nil)
+	if leaf == nil && fold {
+		if ciPath, found := n.findCaseInsensitivePath(path, false); found {
+			// the static parts of ciPath are in the case of the route
+			if l, p, _ := n.find(string(ciPath), nil); l != nil {
+				return l, p, false
+			}
+		}
+	}
+	return leaf, params, tsr
+}
+
+// find walks the tree from n to look up path and returns the leaf of the
+// matched route, nil if none. The ps parameters, already matched by the
+// ancestors of n, are completed with the ones of the matched route.
+func (n *node) find(path string, ps ParamHolder) (leaf *node, params ParamHolder, tsr bool) {
+	params = ps
 walk: // Outer loop for walking the tree
 	for {
+		switch {
+		case n.nType == parameter:
+			end := n.paramEnd(path)
+
+			// the value must satisfy the constraint of the parameter
+			if n.constraint != nil && !n.constraint.match(path[:end]) {
+				return
+			}
+
+			// save param value
+			if params == nil {
+				// lazy allocation
+				params = make(ParamHolder, 0, n.maxParams)
+			}
+			i := len(params)
+			params = params[:i+1] // expand slice within preallocated capacity
+			params[i].Name = n.paramName()
+			params[i].Value = path[:end]
+
+			// we need to go deeper!
+			if end < len(path) {
+				if len(n.children) > 0 {
+					path = path[end:]
+					n = n.children[0]
+					continue walk
+				}
+
+				// ... but we can't
+				tsr = tsr || (len(path) == end+1)
+				return
+			}
+
+			if n.handler != nil {
+				leaf, params = n, n.withDefaults(params)
+				return
+			} else if len(n.children) == 1 {
+				// No handle found. Check if a handle for this path + a
+				// trailing slash exists for TSR recommendation
+				n = n.next('/')
+				tsr = tsr || (n != nil && n.path == "/" && n.handler != nil)
+			}
+
+			return
+
+		case n.nType == catchAll && !n.wildChild:
+			// save param value
+			if params == nil {
+				// lazy allocation
+				params = make(ParamHolder, 0, n.maxParams)
+			}
+			i := len(params)
+			params = params[:i+1] // expand slice within preallocated capacity
+			params[i].Name = n.path[2:]
+			params[i].Value = path
+			leaf, params = n, n.withDefaults(params)
+			return
+
+		case n.nType > catchAll:
+			panic("invalid node type")
+		}
+
 		if len(path) > len(n.path) {
 			if path[:len(n.path)] == n.path {
 				path = path[len(n.path):]
-				// If this node does not have a wildcard (parameter or catchAll)
-				// child,  we can just look up the next child node and continue
-				// to walk down the tree
-				if !n.wildChild {
-					c := path[0]
-					for i := 0; i < len(n.indices); i++ {
-						if c == n.indices[i] {
+				// Look up the static child for the next path byte. If this node
+				// does not have a wildcard (parameter or catchAll) child, we
+				// can just continue to walk down the tree. Otherwise the static
+				// child takes priority: it is tried first and we backtrack to
+				// the wildcard children if it can't match.
+				c := path[0]
+				for i := 0; i < len(n.indices); i++ {
+					if c == n.indices[i] {
+						if !n.wildChild {
 							n = n.children[i]
 							continue walk
 						}
+						l, p, t := n.children[i].find(path, params)
+						if l != nil {
+							return l, p, t
+						}
+						tsr = t
+						break
 					}
+				}
 
+				if !n.wildChild {
 					// Nothing found.
 					// We can recommend to redirect to the same URL without a
 					// trailing slash if a leaf exists for that path.
-					tsr = (path == "/" && n.handler != nil)
+					tsr = tsr || (path == "/" && n.handler != nil)
 					return
-
 				}
 
-				// handle wildcard child
-				n = n.children[0]
-				switch n.nType {
-				case parameter:
-					// find parameter end (either '/' or path end)
-					end := 0
-					for end < len(path) && path[end] != '/' {
-						end++
-					}
-
-					// save param value
-					if params == nil {
-						// lazy allocation
-						params = make(ParamHolder, 0, n.maxParams)
-					}
-					i := len(params)
-					params = params[:i+1] // expand slice within preallocated capacity
-					params[i].Name = n.path[1:]
-					params[i].Value = path[:end]
-
-					// we need to go deeper!
-					if end < len(path) {
-						if len(n.children) > 0 {
-							path = path[end:]
-							n = n.children[0]
-							continue walk
-						}
-
-						// ... but we can't
-						tsr = (len(path) == end+1)
-						return
-					}
-
-					if handler = n.handler; handler != nil {
-						return
-					} else if len(n.children) == 1 {
-						// No handle found. Check if a handle for this path + a
-						// trailing slash exists for TSR recommendation
-						n = n.children[0]
-						tsr = (n.path == "/" && n.handler != nil)
-					}
-
-					return
-
-				case catchAll:
-					// find param end (either '/' or path end)
-					end := 0
-					for end < len(path) && path[end] != '/' {
-						end++
-					}
-
-					// save param value
-					if params == nil {
-						// lazy allocation
-						params = make(ParamHolder, 0, n.maxParams)
+				// handle wildcard children: constrained parameters are tried
+				// in turn before the last one
+				wild := n.children[len(n.indices):]
+				for _, child := range wild[:len(wild)-1] {
+					l, p, t := child.find(path, params)
+					if l != nil {
+						return l, p, t
 					}
-					i := len(params)
-					params = params[:i+1] // expand slice within preallocated capacity
-					params[i].Name = n.path[2:]
-					params[i].Value = path
-					handler = n.handler
-					return
-
-				default:
-					panic("invalid node type")
+					tsr = tsr || t
 				}
+				n = wild[len(wild)-1]
+				continue walk
 			}
 		} else if path == n.path {
 			// We should have reached the node containing the handle.
 			// Check if this node has a handle registered.
-			if handler = n.handler; handler != nil {
+			if n.handler != nil {
+				leaf, params = n, n.withDefaults(params)
 				return
 			}
 
@@ -432,7 +825,7 @@ walk: // Outer loop for walking the tree
 			for i := 0; i < len(n.indices); i++ {
 				if n.indices[i] == '/' {
 					n = n.children[i]
-					tsr = (len(n.path) == 1 && n.handler != nil) ||
+					tsr = tsr || (len(n.path) == 1 && n.handler != nil) ||
 						(n.nType == catchAll && n.children[0].handler != nil)
 					return
 				}
@@ -443,13 +836,50 @@ walk: // Outer loop for walking the tree
 
 		// Nothing found. We can recommend to redirect to the same URL with an
 		// extra trailing slash if a leaf exists for that path
-		tsr = (path == "/") ||
+		tsr = tsr || (path == "/") ||
 			(len(n.path) == len(path)+1 && n.path[len(path)] == '/' &&
 				path == n.path[:len(n.path)-1] && n.handler != nil)
 		return
 	}
 }
 
+// walk calls fn for each handler of the tree with the pattern it was
+// registered with, once for all the variants of a pattern with optional
+// parameters. Static children are visited in the order of their index char,
+// before the wildcard child, so the traversal order does not depend on the
+// registration order.
+func (n *node) walk(fn func(pattern string, handler xhandler.HandlerC) error) error {
+	return n.walkRoutes(map[string]bool{}, fn)
+}
+
+func (n *node) walkRoutes(seen map[string]bool, fn func(pattern string, handler xhandler.HandlerC) error) error {
+	if n.handler != nil && !seen[n.registered] {
+		seen[n.registered] = true
+		if err := fn(n.registered, n.handler); err != nil {
+			return err
+		}
+	}
+	order := make([]int, len(n.indices))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return n.indices[order[i]] < n.indices[order[j]]
+	})
+	for _, i := range order {
+		if err := n.children[i].walkRoutes(seen, fn); err != nil {
+			return err
+		}
+	}
+	// wildcard child or child of a parameter
+	for _, child := range n.children[len(n.indices):] {
+		if err := child.walkRoutes(seen, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Makes a case-insensitive lookup of the given path and tries to find a handler.
 // It can optionally also fix trailing slashes.
 // It returns the case-corrected path and a bool indicating whether the lookup
@@ -463,73 +893,47 @@ func (n *node) findCaseInsensitivePath(path string, fixTrailingSlash bool) (ciPa
 		ciPath = append(ciPath, n.path...)
 
 		if len(path) > 0 {
-			// If this node does not have a wildcard (parameter or catchAll) child,
-			// we can just look up the next child node and continue to walk down
-			// the tree
-			if !n.wildChild {
-				r := unicode.ToLower(rune(path[0]))
-				for i, index := range n.indices {
-					// must use recursive approach since both index and
-					// ToLower(index) could exist. We must check both.
-					if r == unicode.ToLower(index) {
-						out, found := n.children[i].findCaseInsensitivePath(path, fixTrailingSlash)
-						if found {
-							return append(ciPath, out...), true
-						}
+			// Look up the static children first, then the wildcard
+			// (parameter or catchAll) child if any
+			r := unicode.ToLower(rune(path[0]))
+			for i, index := range n.indices {
+				// must use recursive approach since both index and
+				// ToLower(index) could exist. We must check both.
+				if r == unicode.ToLower(index) {
+					out, found := n.children[i].findCaseInsensitivePath(path, fixTrailingSlash)
+					if found {
+						return append(ciPath, out...), true
 					}
 				}
-
-				// Nothing found. We can recommend to redirect to the same URL
-				// without a trailing slash if a leaf exists for that path
-				found = (fixTrailingSlash && path == "/" && n.handler != nil)
-				return
 			}
 
-			n = n.children[0]
-			switch n.nType {
-			case parameter:
-				// find parameter end (either '/' or path end)
-				k := 0
-				for k < len(path) && path[k] != '/' {
-					k++
-				}
+			// We can recommend to redirect to the same URL without a
+			// trailing slash if a leaf exists for that path
+			if fixTrailingSlash && path == "/" && n.handler != nil {
+				return ciPath, true
+			}
 
-				// add parameter value to case insensitive path
-				ciPath = append(ciPath, path[:k]...)
+			if !n.wildChild {
+				// Nothing found.
+				return
+			}
 
-				// we need to go deeper!
-				if k < len(path) {
-					if len(n.children) > 0 {
-						path = path[k:]
-						n = n.children[0]
-						continue
+			for _, child := range n.children[len(n.indices):] {
+				switch child.nType {
+				case parameter:
+					out, found := child.findCaseInsensitiveParam(path, fixTrailingSlash)
+					if found {
+						return append(ciPath, out...), true
 					}
 
-					// ... but we can't
-					if fixTrailingSlash && len(path) == k+1 {
-						return ciPath, true
-					}
-					return
-				}
+				case catchAll:
+					return append(ciPath, path...), true
 
-				if n.handler != nil {
-					return ciPath, true
-				} else if fixTrailingSlash && len(n.children) == 1 {
-					// No handle found. Check if a handle for this path + a
-					// trailing slash exists
-					n = n.children[0]
-					if n.path == "/" && n.handler != nil {
-						return append(ciPath, '/'), true
-					}
+				default:
+					panic("invalid node type")
 				}
-				return
-
-			case catchAll:
-				return append(ciPath, path...), true
-
-			default:
-				panic("invalid node type")
 			}
+			return
 		} else {
 			// We should have reached the node containing the handle.
 			// Check if this node has a handle registered.
@@ -556,11 +960,9 @@ func (n *node) findCaseInsensitivePath(path string, fixTrailingSlash bool) (ciPa
 	}
 
 	// Nothing found.
-	// Try to fix the path by adding / removing a trailing slash
+	// Try to fix the path by adding a trailing slash, removing it is left to
+	// the parent which knows if it has a handle
 	if fixTrailingSlash {
-		if path == "/" {
-			return ciPath, true
-		}
 		if len(path)+1 == len(n.path) && n.path[len(path)] == '/' &&
 			strings.ToLower(path) == strings.ToLower(n.path[:len(path)]) &&
 			n.handler != nil {
@@ -569,3 +971,47 @@ func (n *node) findCaseInsensitivePath(path string, fixTrailingSlash bool) (ciPa
 	}
 	return
 }
+
+// findCaseInsensitiveParam is the findCaseInsensitivePath counterpart for a
+// parameter node: it matches the parameter value against the constraint of
+// the node and continues the lookup with the rest of the path.
+func (n *node) findCaseInsensitiveParam(path string, fixTrailingSlash bool) (ciPath []byte, found bool) {
+	k := n.paramEnd(path)
+	if n.constraint != nil && !n.constraint.match(path[:k]) {
+		return
+	}
+
+	// add parameter value to case insensitive path
+	ciPath = append(ciPath, path[:k]...)
+
+	// we need to go deeper!
+	if k < len(path) {
+		if len(n.children) > 0 {
+			if out, found := n.children[0].findCaseInsensitivePath(path[k:], fixTrailingSlash); found {
+				return append(ciPath, out...), true
+			}
+			if fixTrailingSlash && path[k:] == "/" && n.handler != nil {
+				return ciPath, true
+			}
+			return nil, false
+		}
+
+		// ... but we can't
+		if fixTrailingSlash && len(path) == k+1 {
+			return ciPath, true
+		}
+		return
+	}
+
+	if n.handler != nil {
+		return ciPath, true
+	} else if fixTrailingSlash && len(n.children) == 1 {
+		// No handle found. Check if a handle for this path + a
+		// trailing slash exists
+		n = n.next('/')
+		if n != nil && n.path == "/" && n.handler != nil {
+			return append(ciPath, '/'), true
+		}
+	}
+	return
+}
@@ -116,6 +116,9 @@ func TestCountParams(t *testing.T) {
 	if countParams(strings.Repeat("/:param", 256)) != 255 {
 		t.Fail()
 	}
+	if countParams("/path/:id{[:*]+}/*catch-all") != 2 {
+		t.Fail()
+	}
 }
 
 func TestTreeAddAndGet(t *testing.T) {
@@ -211,6 +214,106 @@ func TestTreeWildcard(t *testing.T) {
 	checkMaxParams(t, tree)
 }
 
+func TestTreeRemove(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		"/",
+		"/cmd/:tool/:sub",
+		"/cmd/:tool/",
+		"/src/*filepath",
+		"/search/",
+		"/search/:query",
+		"/user_:name",
+		"/user_:name/about",
+		"/files/:dir/*filepath",
+		"/doc/",
+		"/doc/go_faq.html",
+		"/doc/go1.html",
+		"/info/:user/public",
+		"/info/:user/project/:project",
+	}
+	for _, route := range routes {
+		tree.addRoute(route, fakeHandler(route))
+	}
+
+	removed := []string{
+		"/cmd/:tool/:sub",
+		"/src/*filepath",
+		"/search/",
+		"/user_:name/about",
+		"/files/:dir/*filepath",
+		"/doc/go_faq.html",
+		"/info/:user/project/:project",
+	}
+	for _, route := range removed {
+		if !tree.removeRoute(route) {
+			t.Errorf("route '%s' not removed", route)
+		}
+		if tree.removeRoute(route) {
+			t.Errorf("route '%s' removed twice", route)
+		}
+	}
+	for _, route := range []string{"/nope", "/cmd/:too/", "/cmd/:tool", "/doc"} {
+		if tree.removeRoute(route) {
+			t.Errorf("unregistered route '%s' removed", route)
+		}
+	}
+
+	//printChildren(tree, "")
+
+	checkRequests(t, tree, testRequests{
+		{"/", false, "/", emptyParams},
+		{"/cmd/test/", false, "/cmd/:tool/", newParams("tool", "test")},
+		{"/search/someth!ng", false, "/search/:query", newParams("query", "someth!ng")},
+		{"/user_gopher", false, "/user_:name", newParams("name", "gopher")},
+		{"/doc/", false, "/doc/", emptyParams},
+		{"/doc/go1.html", false, "/doc/go1.html", emptyParams},
+		{"/info/gordon/public", false, "/info/:user/public", newParams("user", "gordon")},
+	})
+	for _, path := range []string{"/cmd/test/3", "/src/file.png", "/user_gopher/about", "/files/js/a.js", "/doc/go_faq.html", "/info/gordon/project/go"} {
+		if handler, _, _ := tree.getValue(path); handler != nil {
+			t.Errorf("handle found for removed route '%s'", path)
+		}
+	}
+
+	checkPriorities(t, tree)
+	checkMaxParams(t, tree)
+
+	// The removed routes can be registered again
+	for _, route := range removed {
+		tree.addRoute(route, fakeHandler(route))
+	}
+	checkRequests(t, tree, testRequests{
+		{"/cmd/test/3", false, "/cmd/:tool/:sub", newParams("tool", "test", "sub", "3")},
+		{"/src/some/file.png", false, "/src/*filepath", newParams("filepath", "/some/file.png")},
+		{"/search/", false, "/search/", emptyParams},
+		{"/files/js/inc/framework.js", false, "/files/:dir/*filepath", newParams("dir", "js", "filepath", "/inc/framework.js")},
+		{"/info/gordon/project/go", false, "/info/:user/project/:project", newParams("user", "gordon", "project", "go")},
+	})
+	checkPriorities(t, tree)
+	checkMaxParams(t, tree)
+}
+
+func TestTreeRemoveMerge(t *testing.T) {
+	tree := &node{}
+	tree.addRoute("/users", fakeHandler("/users"))
+	tree.addRoute("/uploads", fakeHandler("/uploads"))
+
+	if !tree.removeRoute("/uploads") {
+		t.Fatal("route not removed")
+	}
+	if tree.path != "/users" || len(tree.children) != 0 || tree.indices != "" {
+		t.Errorf("edges not merged: path=%s children=%d indices=%s", tree.path, len(tree.children), tree.indices)
+	}
+	checkRequests(t, tree, testRequests{
+		{"/users", false, "/users", emptyParams},
+		{"/uploads", true, "", emptyParams},
+	})
+	checkPriorities(t, tree)
+	checkMaxParams(t, tree)
+}
+
 func catchPanic(testFunc func()) (recv interface{}) {
 	defer func() {
 		recv = recover()
@@ -248,7 +351,8 @@ func testRoutes(t *testing.T, routes []testRoute) {
 func TestTreeWildcardConflict(t *testing.T) {
 	routes := []testRoute{
 		{"/cmd/:tool/:sub", false},
-		{"/cmd/vet", true},
+		{"/cmd/vet", false},
+		{"/cmd/:tool/:subx", true},
 		{"/src/*filepath", false},
 		{"/src/*filepathx", true},
 		{"/src/", true},
@@ -256,12 +360,13 @@ func TestTreeWildcardConflict(t *testing.T) {
 		{"/src1/*filepath", true},
 		{"/src2*filepath", true},
 		{"/search/:query", false},
-		{"/search/invalid", true},
+		{"/search/invalid", false},
+		{"/search/:other", true},
 		{"/user_:name", false},
-		{"/user_x", true},
+		{"/user_x", false},
 		{"/user_:name", false},
 		{"/id:id", false},
-		{"/id/:id", true},
+		{"/id/:id", false},
 	}
 	testRoutes(t, routes)
 }
@@ -269,19 +374,411 @@ func TestTreeWildcardConflict(t *testing.T) {
 func TestTreeChildConflict(t *testing.T) {
 	routes := []testRoute{
 		{"/cmd/vet", false},
-		{"/cmd/:tool/:sub", true},
+		{"/cmd/:tool/:sub", false},
 		{"/src/AUTHORS", false},
 		{"/src/*filepath", true},
 		{"/user_x", false},
-		{"/user_:name", true},
+		{"/user_:name", false},
 		{"/id/:id", false},
-		{"/id:id", true},
-		{"/:id", true},
+		{"/id:id", false},
+		{"/:id", false},
 		{"/*filepath", true},
 	}
 	testRoutes(t, routes)
 }
 
+func TestTreeStaticAndParam(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		"/users/new",
+		"/users/new/settings",
+		"/users/:id",
+		"/users/:id/edit",
+		"/users/:id/edit/",
+		"/users/",
+		"/:page",
+		"/about",
+		"/files/:name/raw",
+		"/files/readme",
+	}
+	for _, route := range routes {
+		recv := catchPanic(func() {
+			tree.addRoute(route, fakeHandler(route))
+		})
+		if recv != nil {
+			t.Fatalf("panic inserting route '%s': %v", route, recv)
+		}
+	}
+
+	//printChildren(tree, "")
+
+	checkRequests(t, tree, testRequests{
+		{"/users/new", false, "/users/new", emptyParams},
+		{"/users/new/settings", false, "/users/new/settings", emptyParams},
+		{"/users/42", false, "/users/:id", newParams("id", "42")},
+		{"/users/ne", false, "/users/:id", newParams("id", "ne")},
+		{"/users/newer", false, "/users/:id", newParams("id", "newer")},
+		{"/users/42/edit", false, "/users/:id/edit", newParams("id", "42")},
+		// backtracking from the static branch
+		{"/users/new/edit", false, "/users/:id/edit", newParams("id", "new")},
+		{"/users/new/edit/", false, "/users/:id/edit/", newParams("id", "new")},
+		{"/users/", false, "/users/", emptyParams},
+		{"/about", false, "/about", emptyParams},
+		{"/abou", false, "/:page", newParams("page", "abou")},
+		{"/users", false, "/:page", newParams("page", "users")},
+		{"/files/readme", false, "/files/readme", emptyParams},
+		{"/files/readme/raw", false, "/files/:name/raw", newParams("name", "readme")},
+		{"/files/readme/other", true, "", newParams("page", "files")},
+	})
+
+	checkPriorities(t, tree)
+	checkMaxParams(t, tree)
+
+	// Trailing slash recommendation
+	for _, route := range []string{"/users/new/", "/users/42/", "/users/new/edit/x"} {
+		handler, _, tsr := tree.getValue(route)
+		if handler != nil {
+			t.Errorf("non-nil handler for TSR route '%s", route)
+		} else if tsr != (route != "/users/new/edit/x") {
+			t.Errorf("wrong TSR recommendation for route '%s'", route)
+		}
+	}
+
+	// Static paths don't allocate
+	allocs := testing.AllocsPerRun(100, func() {
+		tree.getValue("/users/new/settings")
+	})
+	if allocs > 0 {
+		t.Errorf("static lookup allocated %v times", allocs)
+	}
+}
+
+func TestTreeConstraints(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		"/users/:id{[0-9]+}",
+		"/users/:id{[0-9]+}/posts",
+		"/users/:name<alpha>/posts",
+		"/users/:name",
+		"/users/me",
+		"/items/:kind(book|film)",
+		"/items/:id<uuid>/:rev<uint>",
+		"/tags/:tag{(a|b)/?}",
+		"/hex/:v<hex>",
+	}
+	for _, route := range routes {
+		recv := catchPanic(func() {
+			tree.addRoute(route, fakeHandler(route))
+		})
+		if recv != nil {
+			t.Fatalf("panic inserting route '%s': %v", route, recv)
+		}
+	}
+
+	//printChildren(tree, "")
+
+	const uuid = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	checkRequests(t, tree, testRequests{
+		{"/users/42", false, "/users/:id{[0-9]+}", newParams("id", "42")},
+		{"/users/42/posts", false, "/users/:id{[0-9]+}/posts", newParams("id", "42")},
+		{"/users/bob/posts", false, "/users/:name<alpha>/posts", newParams("name", "bob")},
+		{"/users/bob", false, "/users/:name", newParams("name", "bob")},
+		{"/users/me", false, "/users/me", emptyParams},
+		{"/items/book", false, "/items/:kind(book|film)", newParams("kind", "book")},
+		{"/items/" + uuid + "/3", false, "/items/:id<uuid>/:rev<uint>", newParams("id", uuid, "rev", "3")},
+		{"/tags/a", false, "/tags/:tag{(a|b)/?}", newParams("tag", "a")},
+		{"/hex/c0ffee", false, "/hex/:v<hex>", newParams("v", "c0ffee")},
+	})
+	for _, route := range []string{
+		"/users/b0b/posts",
+		"/items/song",
+		"/items/" + uuid + "/-1",
+		"/items/42/3",
+		"/tags/c",
+		"/hex/xyz",
+	} {
+		if handler, _, _ := tree.getValue(route); handler != nil {
+			t.Errorf("non-nil handler for route '%s' failing its constraint", route)
+		}
+	}
+
+	checkPriorities(t, tree)
+	checkMaxParams(t, tree)
+
+	// Case-insensitive lookups honor constraints
+	if out, found := tree.findCaseInsensitivePath("/ITEMS/book", false); !found || string(out) != "/items/book" {
+		t.Errorf("wrong case-insensitive result for '/ITEMS/book': %s, %v", out, found)
+	}
+	if _, found := tree.findCaseInsensitivePath("/ITEMS/BOOK", false); found {
+		t.Errorf("found case-insensitive result for '/ITEMS/BOOK' failing its constraint")
+	}
+
+	// Removing a constrained route keeps its siblings
+	if !tree.removeRoute("/users/:name<alpha>/posts") {
+		t.Fatal("constrained route not removed")
+	}
+	if tree.removeRoute("/users/:name<alpha>/posts") {
+		t.Fatal("constrained route removed twice")
+	}
+	checkRequests(t, tree, testRequests{
+		{"/users/42/posts", false, "/users/:id{[0-9]+}/posts", newParams("id", "42")},
+		{"/users/bob", false, "/users/:name", newParams("name", "bob")},
+	})
+	checkPriorities(t, tree)
+	checkMaxParams(t, tree)
+}
+
+func TestTreeConstraintConflict(t *testing.T) {
+	routes := []testRoute{
+		{"/users/:id{[0-9]+}", false},
+		{"/users/:id<int>", false},
+		{"/users/:name", false},
+		{"/users/:other", true},
+		{"/users/*path", true},
+		{"/users/:slug<alpha>", false},
+		{"/users/:slug<alpha>:x", true},
+		{"/files/*path", false},
+		{"/files/:id<int>", true},
+	}
+	testRoutes(t, routes)
+}
+
+func TestTreeInvalidConstraint(t *testing.T) {
+	for _, route := range []string{
+		"/users/:id{[0-9]+",
+		"/users/:id<int",
+		"/users/:id{[0-9}",
+		"/users/:id<number>",
+		"/users/:id(a||b)",
+		"/users/:id{" + strings.Repeat("a", maxConstraintLen+1) + "}",
+		"/users/:id{(a{1,100}){1,100}}",
+		"/users/:{[0-9]+}",
+	} {
+		tree := &node{}
+		recv := catchPanic(func() {
+			tree.addRoute(route, nil)
+		})
+		if recv == nil {
+			t.Errorf("no panic for invalid constraint in route '%s'", route)
+		}
+	}
+}
+
+func TestTreeSegmentParams(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		"/files/:name.:ext",
+		"/files/:name.json",
+		"/files/:name",
+		"/files/:name/raw",
+		"/v:major/api",
+		"/v1/api",
+		"/posts/:id<int>-:slug",
+		"/posts/:id<int>",
+		"/posts/:title",
+		"/at/@:user",
+	}
+	for _, route := range routes {
+		recv := catchPanic(func() {
+			tree.addRoute(route, fakeHandler(route))
+		})
+		if recv != nil {
+			t.Fatalf("panic inserting route '%s': %v", route, recv)
+		}
+	}
+
+	//printChildren(tree, "")
+
+	checkRequests(t, tree, testRequests{
+		{"/files/app.js", false, "/files/:name.:ext", newParams("name", "app", "ext", "js")},
+		{"/files/app.tar.gz", false, "/files/:name.:ext", newParams("name", "app", "ext", "tar.gz")},
+		{"/files/app.json", false, "/files/:name.json", newParams("name", "app")},
+		{"/files/.json", false, "/files/:name.json", newParams("name", "")},
+		// like a whole segment parameter, a parameter followed by static
+		// text in its segment matches an empty value
+		{"/files/.js", false, "/files/:name.:ext", newParams("name", "", "ext", "js")},
+		{"/v/api", false, "/v:major/api", newParams("major", "")},
+		{"/files/app", false, "/files/:name", newParams("name", "app")},
+		{"/files/app/raw", false, "/files/:name/raw", newParams("name", "app")},
+		{"/v2/api", false, "/v:major/api", newParams("major", "2")},
+		{"/v1/api", false, "/v1/api", emptyParams},
+		{"/posts/42-hello-world", false, "/posts/:id<int>-:slug", newParams("id", "42", "slug", "hello-world")},
+		{"/posts/42", false, "/posts/:id<int>", newParams("id", "42")},
+		{"/posts/hello-world", false, "/posts/:title", newParams("title", "hello-world")},
+		{"/at/@rs", false, "/at/@:user", newParams("user", "rs")},
+	})
+
+	checkPriorities(t, tree)
+	checkMaxParams(t, tree)
+
+	// Trailing slash recommendation
+	for _, route := range []string{"/files/app.js/", "/files/app/", "/v2/api/", "/posts/42/"} {
+		handler, _, tsr := tree.getValue(route)
+		if handler != nil {
+			t.Errorf("non-nil handler for TSR route '%s", route)
+		} else if !tsr {
+			t.Errorf("expected TSR recommendation for route '%s'", route)
+		}
+	}
+
+	if out, found := tree.findCaseInsensitivePath("/FILES/App.JSON", false); !found || string(out) != "/files/App.json" {
+		t.Errorf("wrong case-insensitive result for '/FILES/App.JSON': %s, %v", out, found)
+	}
+
+	for _, route := range routes {
+		if !tree.removeRoute(route) {
+			t.Fatalf("route '%s' not removed", route)
+		}
+		checkPriorities(t, tree)
+		checkMaxParams(t, tree)
+	}
+	if len(tree.children) != 0 || tree.handler != nil {
+		t.Error("tree not empty after removing all the routes")
+	}
+}
+
+func TestTreeSegmentParamsConflict(t *testing.T) {
+	routes := []testRoute{
+		{"/files/:name.:ext", false},
+		{"/files/:base.txt", true},
+		{"/files/:name.:type", true},
+		{"/files/:name-:rev", false},
+		{"/files/:name:rev", true},
+		{"/files/:name.*ext", true},
+		{"/files/:name.:ext/:size", false},
+		{"/posts/:id", false},
+		{"/posts/:id*slug", true},
+	}
+	testRoutes(t, routes)
+}
+
+// Parameter names used to span their whole segment: the names which now end
+// before the segment end change meaning, or panic if they can't be told apart.
+func TestTreeParamNameEnd(t *testing.T) {
+	tree := &node{}
+	tree.addRoute("/u/:user-id", fakeHandler("/u/:user-id"))
+
+	checkRequests(t, tree, testRequests{
+		{"/u/42", true, "", newParams("user", "42")},
+		{"/u/42-id", false, "/u/:user-id", newParams("user", "42")},
+	})
+
+	for path, msg := range map[string]string{
+		"/u/:名前":      "parameter names must be made of ASCII letters, digits and '_', has: ':名前' in path '/u/:名前'",
+		"/u/:userné/x": "parameter names must be made of ASCII letters, digits and '_', has: ':userné' in path '/u/:userné/x'",
+	} {
+		recv := catchPanic(func() {
+			(&node{}).addRoute(path, nil)
+		})
+		if recv != msg {
+			t.Errorf("unexpected panic for route '%s': %v", path, recv)
+		}
+	}
+}
+
+func TestTreeOptional(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		"/docs/:version?=v1/page",
+		"/:lang<alpha>?/about/",
+		"/files/:dir?/:name?",
+	}
+	for _, route := range routes {
+		recv := catchPanic(func() {
+			tree.addRoute(route, fakeHandler(route))
+		})
+		if recv != nil {
+			t.Fatalf("panic inserting route '%s': %v", route, recv)
+		}
+	}
+
+	//printChildren(tree, "")
+
+	checkRequests(t, tree, testRequests{
+		{"/docs/v2/page", false, "/docs/:version?=v1/page", newParams("version", "v2")},
+		{"/docs/page", false, "/docs/:version?=v1/page", newParams("version", "v1")},
+		{"/fr/about/", false, "/:lang<alpha>?/about/", newParams("lang", "fr")},
+		{"/about/", false, "/:lang<alpha>?/about/", emptyParams},
+		{"/f2/about/", true, "", nil},
+		{"/files/a/b", false, "/files/:dir?/:name?", newParams("dir", "a", "name", "b")},
+		{"/files/a", false, "/files/:dir?/:name?", newParams("dir", "a")},
+		{"/files", false, "/files/:dir?/:name?", emptyParams},
+	})
+
+	checkPriorities(t, tree)
+	checkMaxParams(t, tree)
+
+	// Trailing slash recommendation for every variant
+	for _, route := range []string{"/docs/v2/page/", "/docs/page/", "/fr/about", "/about", "/files/a/b/", "/files/"} {
+		handler, _, tsr := tree.getValue(route)
+		if handler != nil {
+			t.Errorf("non-nil handler for TSR route '%s", route)
+		} else if !tsr {
+			t.Errorf("expected TSR recommendation for route '%s'", route)
+		}
+	}
+
+	// A variant is not a registered pattern
+	if tree.removeRoute("/docs/page") || tree.removeRoute("/docs/:version/page") {
+		t.Error("variant of an optional route removed")
+	}
+
+	// Removing the pattern removes all its variants
+	if !tree.removeRoute("/docs/:version?=v1/page") {
+		t.Fatal("optional route not removed")
+	}
+	checkRequests(t, tree, testRequests{
+		{"/docs/v2/page", true, "", newParams("lang", "docs")},
+		{"/docs/page", true, "", newParams("lang", "docs")},
+	})
+	checkPriorities(t, tree)
+	checkMaxParams(t, tree)
+}
+
+func TestExpandOptional(t *testing.T) {
+	tests := []struct {
+		path     string
+		variants []routeVariant
+	}{
+		{"/users/:id", []routeVariant{{"/users/:id", nil}}},
+		{"/re/:id{a?}", []routeVariant{{"/re/:id{a?}", nil}}},
+		{"/:id?", []routeVariant{{"/:id", nil}, {"/", nil}}},
+		{"/a/:id<int>?=1/b", []routeVariant{{"/a/:id<int>/b", nil}, {"/a/b", newParams("id", "1")}}},
+		{"/:x?/:y?=y", []routeVariant{
+			{"/:x/:y", nil},
+			{"/:x", newParams("y", "y")},
+			{"/", newParams("y", "y")},
+		}},
+		{"/:x?/a/:y?", []routeVariant{
+			{"/:x/a/:y", nil},
+			{"/a/:y", nil},
+			{"/:x/a", nil},
+			{"/a", nil},
+		}},
+	}
+	for _, tt := range tests {
+		variants := expandOptional(tt.path)
+		if !reflect.DeepEqual(variants, tt.variants) {
+			t.Errorf("wrong variants for '%s': %v, expected %v", tt.path, variants, tt.variants)
+		}
+	}
+
+	for _, path := range []string{
+		"/a:id?",
+		"/files/*path?",
+		"/:id?default",
+		"/" + strings.Repeat("/:p?", maxOptionalParams+1),
+	} {
+		if recv := catchPanic(func() { expandOptional(path) }); recv == nil {
+			t.Errorf("no panic for invalid optional parameter in path '%s'", path)
+		}
+	}
+}
+
 func TestTreeDupliatePath(t *testing.T) {
 	tree := &node{}
 
@@ -357,7 +854,7 @@ func TestTreeCatchAllConflictRoot(t *testing.T) {
 }
 
 func TestTreeDoubleWildcard(t *testing.T) {
-	const panicMsg = "only one wildcard per path segment is allowed"
+	const panicMsg = "wildcards must be separated by static text"
 
 	routes := [...]string{
 		"/:foo:bar",
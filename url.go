@@ -0,0 +1,225 @@
+package xmux
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Route is a route registered on a Mux.
+type Route struct {
+	ref    *muxRef
+	method string
+	path   string
+	// subtree is true for a subtree pattern of HandlePatternC
+	subtree bool
+	// constraints of the parameters, by name, compiled when the route is named
+	constraints map[string]*constraint
+}
+
+// Name names the route so its URL can be built with Mux.URL. The name must be
+// unique within the muxer.
+func (r *Route) Name(name string) *Route {
+	if name == "" {
+		panic("route name must not be empty for path '" + r.path + "'")
+	}
+	constraints := pathConstraints(r.path)
+	r.ref.mux.Load().update(func(t *table) {
+		r.constraints = constraints
+		t.names.add(name, r)
+	})
+	return r
+}
+
+// pathConstraints returns the constraints of the named parameters of the
+// pattern path, by parameter name.
+func pathConstraints(path string) map[string]*constraint {
+	var cs map[string]*constraint
+	for i := 0; i < len(path); i++ {
+		if path[i] != ':' && path[i] != '*' {
+			continue
+		}
+		nameEnd, end := wildcardEnd(path, i)
+		if end > nameEnd {
+			if cs == nil {
+				cs = make(map[string]*constraint)
+			}
+			name := path[i+1 : nameEnd]
+			cs[name] = newConstraint(name, path[nameEnd:end], path)
+		}
+		i = end - 1
+	}
+	return cs
+}
+
+// URL builds the path of the route registered with the given name. The
+// parameters are given as name/value pairs:
+//  mux.URL("user.show", "id", "42")
+//
+// Named parameter values are percent-encoded, catch-all values are encoded
+// segment by segment. An error is returned if the route does not exist, if a
+// parameter of the route is missing, if a given parameter is not part of the
+// route or if it is given more than once, and if a value does not satisfy the
+// constraint of its parameter or contains the char ending it, like the '.' of
+// :name.:ext.
+//
+// An optional parameter may be omitted. As the consecutive optional parameters
+// are filled from the left, an omitted one followed by a given one is written
+// with its default value, the URL of /docs/:version?=v1/:page? with only page
+// being /docs/v1/page, and an error is returned if it has no default value.
+func (mux *Mux) URL(name string, pairs ...string) (string, error) {
+	if len(pairs)%2 != 0 {
+		return "", errors.New("odd number of parameter name/value pairs")
+	}
+	ps := make(ParamHolder, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		ps = append(ps, Parameter{Name: pairs[i], Value: pairs[i+1]})
+	}
+	return mux.URLParams(name, ps)
+}
+
+// URLParams builds the path of the route registered with the given name using
+// the parameters of ps. See URL.
+func (mux *Mux) URLParams(name string, ps ParamHolder) (string, error) {
+	r := mux.load().names.get(name)
+	if r == nil {
+		return "", fmt.Errorf("no route named '%s'", name)
+	}
+	return buildPath(r.path, r.constraints, ps)
+}
+
+// buildPath replaces the parameters of the pattern path with their value in
+// ps, checking them against the constraints of the parameters.
+func buildPath(path string, constraints map[string]*constraint, ps ParamHolder) (string, error) {
+	for i, p := range ps {
+		for _, q := range ps[:i] {
+			if q.Name == p.Name {
+				return "", fmt.Errorf("duplicate parameter '%s' for path '%s'", p.Name, path)
+			}
+		}
+	}
+
+	used := 0
+	buf := make([]byte, 0, len(path)+16)
+	// omitted optional parameters immediately preceding the current one,
+	// which must be written if it is present as the variants of the route
+	// fill them from the left
+	var omitted []optionalParam
+	omittedEnd := -1
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c != ':' && c != '*' {
+			buf = append(buf, c)
+			continue
+		}
+
+		// find wildcard end, the constraint is not part of the name
+		nameEnd, end := wildcardEnd(path, i)
+		name := path[i+1 : nameEnd]
+		// an optional parameter is followed by '?' and its default value
+		optional := c == ':' && end < len(path) && path[end] == '?'
+		var opt optionalParam
+		if optional {
+			opt = optionalParam{start: i - 1, name: name}
+			if def := end + 1; def < len(path) && path[def] == '=' {
+				opt.hasDef = true
+				for end = def + 1; end < len(path) && path[end] != '/'; end++ {
+				}
+				opt.def = path[def+1 : end]
+			}
+			for end < len(path) && path[end] != '/' {
+				end++
+			}
+			opt.end = end
+			if opt.start != omittedEnd {
+				omitted = nil
+			}
+		}
+		value, found := "", false
+		for _, p := range ps {
+			if p.Name == name {
+				value, found = p.Value, true
+				break
+			}
+		}
+		if !found {
+			if optional {
+				// omit the segment, including its leading '/'
+				buf = buf[:len(buf)-1]
+				omitted, omittedEnd = append(omitted, opt), end
+				i = end - 1
+				continue
+			}
+			return "", fmt.Errorf("missing parameter '%s' for path '%s'", name, path)
+		}
+		used++
+		if optional && len(omitted) > 0 {
+			// write the defaults of the omitted parameters before this one
+			buf = buf[:len(buf)-1]
+			for _, o := range omitted {
+				if !o.hasDef {
+					return "", fmt.Errorf("missing parameter '%s' for path '%s': it precedes '%s'", o.name, path, name)
+				}
+				buf = append(buf, '/')
+				buf = append(buf, url.PathEscape(o.def)...)
+			}
+			buf = append(buf, '/')
+			omitted = nil
+		}
+
+		if c == ':' {
+			if cs := constraints[name]; cs != nil && !cs.match(value) {
+				return "", fmt.Errorf("invalid value '%s' for parameter '%s' of path '%s'", value, name, path)
+			}
+			// the static text following the parameter in its segment ends
+			// its value
+			if end < len(path) && path[end] != '/' && strings.IndexByte(value, path[end]) >= 0 {
+				return "", fmt.Errorf("invalid value '%s' for parameter '%s' of path '%s': it contains '%c'",
+					value, name, path, path[end])
+			}
+			buf = append(buf, url.PathEscape(value)...)
+		} else {
+			// catch-all values include the leading '/' written before the
+			// wildcard
+			buf = buf[:len(buf)-1]
+			if !strings.HasPrefix(value, "/") {
+				value = "/" + value
+			}
+			segments := strings.Split(value, "/")
+			for j := range segments {
+				segments[j] = url.PathEscape(segments[j])
+			}
+			buf = append(buf, strings.Join(segments, "/")...)
+		}
+		i = end - 1
+	}
+
+	if used < len(ps) {
+		for _, p := range ps {
+			if !hasParam(path, p.Name) {
+				return "", fmt.Errorf("unknown parameter '%s' for path '%s'", p.Name, path)
+			}
+		}
+	}
+	if len(buf) == 0 {
+		// all the segments were optional
+		return "/", nil
+	}
+	return string(buf), nil
+}
+
+// hasParam tells if the pattern path has a parameter with the given name.
+func hasParam(path, name string) bool {
+	for i := 0; i < len(path); i++ {
+		if path[i] != ':' && path[i] != '*' {
+			continue
+		}
+		nameEnd, end := wildcardEnd(path, i)
+		if path[i+1:nameEnd] == name {
+			return true
+		}
+		i = end - 1
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package xmux
+
+import (
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"testing"
+
+	"context"
+
+	"github.com/rs/xhandler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMuxURL(t *testing.T) {
+	handlerFunc := xhandler.HandlerFuncC(func(_ context.Context, _ http.ResponseWriter, _ *http.Request) {})
+
+	mux := New()
+	mux.GET("/", handlerFunc).Name("home")
+	mux.GET("/users/:id", handlerFunc).Name("user.show")
+	mux.GET("/files/*filepath", handlerFunc).Name("files")
+	mux.GET("/posts/:id<int>/:slug{[a-z-]+}", handlerFunc).Name("post.show")
+	mux.GET("/docs/:version?=v1/:page?", handlerFunc).Name("docs")
+	mux.GET("/assets/:name.:ext", handlerFunc).Name("asset")
+	mux.GET("/archive/:year?/:month?", handlerFunc).Name("archive")
+	org := mux.NewGroup("/orgs/:org")
+	org.GET("/repos/:repo", handlerFunc).Name("repo.show")
+
+	tests := []struct {
+		name  string
+		pairs []string
+		url   string
+		err   string
+	}{
+		{"home", nil, "/", ""},
+		{"user.show", []string{"id", "42"}, "/users/42", ""},
+		{"user.show", []string{"id", "a b/c?"}, "/users/a%20b%2Fc%3F", ""},
+		{"files", []string{"filepath", "/css/main app.css"}, "/files/css/main%20app.css", ""},
+		{"files", []string{"filepath", "LICENSE"}, "/files/LICENSE", ""},
+		{"files", []string{"filepath", "/"}, "/files/", ""},
+		{"repo.show", []string{"org", "rs", "repo", "xmux"}, "/orgs/rs/repos/xmux", ""},
+		{"post.show", []string{"id", "1", "slug", "hello"}, "/posts/1/hello", ""},
+		{"docs", []string{"version", "v2", "page", "intro"}, "/docs/v2/intro", ""},
+		{"docs", []string{"version", "v2"}, "/docs/v2", ""},
+		{"docs", nil, "/docs", ""},
+		{"docs", []string{"page", "intro"}, "/docs/v1/intro", ""},
+		{"archive", []string{"year", "2016"}, "/archive/2016", ""},
+		{"archive", []string{"month", "01"}, "", "missing parameter 'year' for path '/archive/:year?/:month?': it precedes 'month'"},
+		{"asset", []string{"name", "app", "ext", "tar.gz"}, "/assets/app.tar.gz", ""},
+		{"asset", []string{"name", "", "ext", "js"}, "/assets/.js", ""},
+		{"asset", []string{"name", "a.b", "ext", "js"}, "", "invalid value 'a.b' for parameter 'name' of path '/assets/:name.:ext': it contains '.'"},
+		{"user.show", nil, "", "missing parameter 'id' for path '/users/:id'"},
+		{"repo.show", []string{"repo", "xmux"}, "", "missing parameter 'org' for path '/orgs/:org/repos/:repo'"},
+		{"user.show", []string{"id", "42", "foo", "bar"}, "", "unknown parameter 'foo' for path '/users/:id'"},
+		{"user.show", []string{"id"}, "", "odd number of parameter name/value pairs"},
+		{"user.show", []string{"id", "1", "id", "2"}, "", "duplicate parameter 'id' for path '/users/:id'"},
+		{"post.show", []string{"id", "abc", "slug", "hello"}, "", "invalid value 'abc' for parameter 'id' of path '/posts/:id<int>/:slug{[a-z-]+}'"},
+		{"post.show", []string{"id", "1", "slug", "Hello"}, "", "invalid value 'Hello' for parameter 'slug' of path '/posts/:id<int>/:slug{[a-z-]+}'"},
+		{"nope", nil, "", "no route named 'nope'"},
+	}
+	for _, tt := range tests {
+		url, err := mux.URL(tt.name, tt.pairs...)
+		if tt.err != "" {
+			if assert.Error(t, err, tt.name) {
+				assert.Equal(t, tt.err, err.Error())
+			}
+			continue
+		}
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.url, url)
+
+		// the URL is routed back to the route with the same parameters,
+		// except for the encoded slashes routed like slashes
+		if strings.Contains(url, "%2F") {
+			continue
+		}
+		path, _ := neturl.PathUnescape(url)
+		handler, ps, _ := mux.Lookup("GET", path)
+		assert.NotNil(t, handler, url)
+		for i := 0; i < len(tt.pairs); i += 2 {
+			v, found := ps.Lookup(tt.pairs[i])
+			assert.True(t, found, "%s: %s", url, tt.pairs[i])
+			assert.Equal(t, strings.TrimPrefix(tt.pairs[i+1], "/"), strings.TrimPrefix(v, "/"), url)
+		}
+	}
+
+	url, err := mux.URLParams("user.show", ParamHolder{{"id", "42"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "/users/42", url)
+}
+
+func TestRouteNameConflict(t *testing.T) {
+	handlerFunc := xhandler.HandlerFuncC(func(_ context.Context, _ http.ResponseWriter, _ *http.Request) {})
+
+	mux := New()
+	mux.GET("/a", handlerFunc).Name("a")
+	assert.Panics(t, func() {
+		mux.GET("/b", handlerFunc).Name("a")
+	})
+	assert.Panics(t, func() {
+		mux.GET("/c", handlerFunc).Name("")
+	})
+}
@@ -0,0 +1,139 @@
+package xmux
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/rs/xhandler"
+)
+
+// versionSwitch is the handler registered in the tree for a method and path
+// with versioned routes. It serves the handler of the version asked by the
+// request.
+type versionSwitch struct {
+	ref *muxRef
+	// versions in registration order, handlers indexed by normalized version
+	versions []string
+	handlers map[string]xhandler.HandlerC
+}
+
+// Version returns a group registering routes for the given API version. The
+// same method and path can be registered for several versions, the handler
+// being chosen from the request headers:
+//  mux.Version("v1").GET("/items", ListItemsV1)
+//  mux.Version("v2").GET("/items", ListItemsV2)
+//
+// The version asked by a request is read with VersionFunc, RequestVersion by
+// default. Versions are compared without their optional leading 'v', so "2"
+// and "v2" are the same version. Requests not asking for a version are served
+// by DefaultVersion. Requests for a version not registered for the path, or
+// not asking for one with no DefaultVersion, are answered with 406 (Not
+// Acceptable) and the list of the versions registered for the path.
+//
+// A path registered with versions can't be registered without a version for
+// the same method.
+func (mux *Mux) Version(version string) *Group {
+	return &Group{m: mux, version: checkVersion(version)}
+}
+
+func checkVersion(version string) string {
+	if normalizeVersion(version) == "" {
+		panic("empty version '" + version + "'")
+	}
+	return version
+}
+
+// normalizeVersion strips the leading 'v' of version.
+func normalizeVersion(version string) string {
+	if len(version) > 0 && (version[0] == 'v' || version[0] == 'V') {
+		return version[1:]
+	}
+	return version
+}
+
+// RequestVersion returns the API version asked by the request: the value of
+// the Api-Version header, or else the version of a vendor media type of the
+// Accept header, like v2 in application/vnd.acme.v2+json. The last label of a
+// vendor media type is only a version if made of digits after an optional 'v',
+// so application/vnd.oasis.opendocument.text asks for none. It returns an empty
+// string if the request doesn't ask for a version.
+func RequestVersion(r *http.Request) string {
+	if v := strings.TrimSpace(r.Header.Get("Api-Version")); v != "" {
+		return v
+	}
+	for _, accept := range r.Header["Accept"] {
+		for _, mt := range strings.Split(accept, ",") {
+			if i := strings.IndexByte(mt, ';'); i >= 0 {
+				mt = mt[:i]
+			}
+			i := strings.Index(mt, "/vnd.")
+			if i < 0 {
+				continue
+			}
+			sub := mt[i+len("/vnd."):]
+			if j := strings.IndexByte(sub, '+'); j >= 0 {
+				sub = sub[:j]
+			}
+			if j := strings.LastIndexByte(sub, '.'); j >= 0 {
+				if v := strings.TrimSpace(sub[j+1:]); isDigits(normalizeVersion(v)) {
+					return v
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// handleVersion registers handler for the version of the route of path in
+// root, a tree of the table t being updated, key identifying the route in
+// t.versions.
+func (mux *Mux) handleVersion(t *table, root *node, key, path, pattern, version string, handler xhandler.HandlerC) {
+	vs := &versionSwitch{ref: mux.ref(), handlers: map[string]xhandler.HandlerC{}}
+	if prev := t.versions[key]; prev != nil {
+		// the switch of the previous table is replaced by a copy
+		vs.versions = append(vs.versions, prev.versions...)
+		for v, h := range prev.handlers {
+			vs.handlers[v] = h
+		}
+		root.removeRoute(path)
+	}
+	v := normalizeVersion(version)
+	if _, found := vs.handlers[v]; found {
+		panic("a handler is already registered for version '" + version + "' of path '" + path + "'")
+	}
+	vs.versions = append(vs.versions, version)
+	vs.handlers[v] = handler
+	root.addPattern(path, pattern, vs)
+	t.writeVersions()[key] = vs
+}
+
+func (vs *versionSwitch) ServeHTTPC(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	mux := vs.ref.mux.Load()
+	o := mux.opts()
+	version := ""
+	if o.VersionFunc != nil {
+		version = o.VersionFunc(r)
+	} else {
+		version = RequestVersion(r)
+	}
+	if version == "" {
+		version = o.DefaultVersion
+	}
+	if version != "" {
+		if h := vs.handlers[normalizeVersion(version)]; h != nil {
+			h.ServeHTTPC(ctx, w, r)
+			return
+		}
+	}
+
+	handler := xhandler.HandlerFuncC(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if o.NotAcceptable != nil {
+			o.NotAcceptable(ctx, w, r, vs.versions)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusNotAcceptable)+", supported versions: "+
+			strings.Join(vs.versions, ", "), http.StatusNotAcceptable)
+	})
+	mux.serveOutcome(ctx, w, r, OutcomeNotAcceptable, handler)
+}
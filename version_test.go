@@ -0,0 +1,105 @@
+package xmux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"context"
+
+	"github.com/rs/xhandler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestVersion(t *testing.T) {
+	tests := []struct {
+		header, value string
+		version       string
+	}{
+		{"", "", ""},
+		{"Api-Version", "2", "2"},
+		{"Api-Version", " v3 ", "v3"},
+		{"Accept", "application/vnd.acme.v2+json", "v2"},
+		{"Accept", "text/html, application/vnd.acme.v1+json; q=0.9", "v1"},
+		{"Accept", "application/vnd.acme+json", ""},
+		{"Accept", "application/json", ""},
+		{"Accept", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet, */*", ""},
+		{"Accept", "application/vnd.ms-excel, application/vnd.acme.V3+json", "V3"},
+		{"Accept", "application/vnd.acme.v+json", ""},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest("GET", "/", nil)
+		if tt.header != "" {
+			r.Header.Set(tt.header, tt.value)
+		}
+		assert.Equal(t, tt.version, RequestVersion(r), "%s: %s", tt.header, tt.value)
+	}
+}
+
+func TestMuxVersion(t *testing.T) {
+	handler := func(name string) xhandler.HandlerFuncC {
+		return func(ctx context.Context, w http.ResponseWriter, _ *http.Request) {
+			w.Write([]byte(name + " " + Param(ctx, "id")))
+		}
+	}
+
+	mux := New()
+	mux.Version("v1").GET("/items/:id", handler("v1"))
+	mux.Version("2").GET("/items/:id", handler("v2"))
+	mux.Version("v1").NewGroup("/api").POST("/items", handler("v1 post"))
+	mux.GET("/status", handler("status"))
+
+	assert.Panics(t, func() { mux.Version("v2").GET("/items/:id", handler("dup")) })
+	assert.Panics(t, func() { mux.GET("/items/:id", handler("unversioned")) })
+	assert.Panics(t, func() { mux.Version("v") })
+
+	tests := []struct {
+		method, path, header, value string
+		code                        int
+		body                        string
+	}{
+		{"GET", "/items/1", "Accept", "application/vnd.acme.v2+json", 200, "v2 1"},
+		{"GET", "/items/1", "Api-Version", "v1", 200, "v1 1"},
+		{"GET", "/items/1", "Api-Version", "3", 406, "Not Acceptable, supported versions: v1, 2\n"},
+		{"GET", "/items/1", "", "", 406, "Not Acceptable, supported versions: v1, 2\n"},
+		{"POST", "/api/items", "Api-Version", "1", 200, "v1 post "},
+		{"GET", "/status", "Api-Version", "3", 200, "status "},
+	}
+	for _, tt := range tests {
+		r, _ := http.NewRequest(tt.method, tt.path, nil)
+		if tt.header != "" {
+			r.Header.Set(tt.header, tt.value)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTPC(context.Background(), w, r)
+		assert.Equal(t, tt.code, w.Code, "%s %s", tt.header, tt.value)
+		assert.Equal(t, tt.body, w.Body.String(), "%s %s", tt.header, tt.value)
+	}
+
+	// Default version and custom 406
+	mux.DefaultVersion = "v2"
+	var versions []string
+	mux.NotAcceptable = func(_ context.Context, w http.ResponseWriter, _ *http.Request, v []string) {
+		versions = v
+		w.WriteHeader(http.StatusNotAcceptable)
+	}
+	r, _ := http.NewRequest("GET", "/items/1", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTPC(context.Background(), w, r)
+	assert.Equal(t, "v2 1", w.Body.String())
+	r.Header.Set("Api-Version", "4")
+	w = httptest.NewRecorder()
+	mux.ServeHTTPC(context.Background(), w, r)
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+	assert.Equal(t, []string{"v1", "2"}, versions)
+
+	routes := mux.Routes()
+	if assert.Len(t, routes, 4) {
+		assert.Equal(t, "v1", routes[0].Version)
+		assert.Equal(t, "2", routes[1].Version)
+		assert.Equal(t, "", routes[2].Version)
+	}
+
+	assert.True(t, mux.Remove("GET", "/items/:id"))
+	mux.GET("/items/:id", handler("unversioned"))
+}